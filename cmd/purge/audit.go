@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+const (
+	clockSourceResources   = "resources"
+	clockSourceAuditEvents = "audit_events"
+)
+
+// auditEventResourceTypes maps the audit events recorded when a resource is
+// created to the resource type they count as
+var auditEventResourceTypes = map[string]string{
+	"audit.app.create":                            resourceTypeApps,
+	"audit.service_instance.create":               resourceTypeServiceInstances,
+	"audit.user_provided_service_instance.create": resourceTypeServiceInstances,
+	"audit.route.create":                          resourceTypeRoutes,
+	"audit.service_binding.create":                resourceTypeCredentialBindings,
+	"audit.service_key.create":                    resourceTypeCredentialBindings,
+	"audit.app.task.create":                       resourceTypeTasks,
+	"audit.app.package.create":                    resourceTypePackages,
+}
+
+// validateClockSource checks that the clock source is known
+func validateClockSource(clockSource string) error {
+	switch clockSource {
+	case clockSourceResources, clockSourceAuditEvents:
+		return nil
+	}
+	return fmt.Errorf("unknown clock source %s", clockSource)
+}
+
+// listCreateEventTypes lists the audit event types recorded when resources of
+// the given types are created
+func listCreateEventTypes(types []string) []string {
+	eventTypes := []string{}
+	for eventType, resourceType := range auditEventResourceTypes {
+		if includesResourceType(types, resourceType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	sort.Strings(eventTypes)
+	return eventTypes
+}
+
+// listCreateEvents fetches the create audit events in an org since a given
+// time, so that deleting and re-creating the oldest resource in a space
+// doesn't reset its clock
+func listCreateEvents(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	org *resource.Organization,
+	types []string,
+	since time.Time,
+) ([]*resource.AuditEvent, error) {
+	auditEventListOptions := client.NewAuditEventListOptions()
+	auditEventListOptions.OrganizationGUIDs.EqualTo(org.GUID)
+	auditEventListOptions.Types.EqualTo(listCreateEventTypes(types)...)
+	auditEventListOptions.CreateAts.AfterOrEqualTo(since)
+	return cfClient.AuditEvents.ListAll(ctx, auditEventListOptions)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockAuditEvents struct {
+	opts *client.AuditEventListOptions
+}
+
+func (a *mockAuditEvents) ListAll(ctx context.Context, opts *client.AuditEventListOptions) ([]*resource.AuditEvent, error) {
+	a.opts = opts
+	return nil, nil
+}
+
+func TestListCreateEventTypes(t *testing.T) {
+	testCases := map[string]struct {
+		types              []string
+		expectedEventTypes []string
+	}{
+		"lists create events for included resource types": {
+			types: []string{resourceTypeApps, resourceTypeServiceInstances},
+			expectedEventTypes: []string{
+				"audit.app.create",
+				"audit.service_instance.create",
+				"audit.user_provided_service_instance.create",
+			},
+		},
+		"lists every create event when no types are set": {
+			expectedEventTypes: []string{
+				"audit.app.create",
+				"audit.app.package.create",
+				"audit.app.task.create",
+				"audit.route.create",
+				"audit.service_binding.create",
+				"audit.service_instance.create",
+				"audit.service_key.create",
+				"audit.user_provided_service_instance.create",
+			},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			eventTypes := listCreateEventTypes(test.types)
+			if diff := cmp.Diff(test.expectedEventTypes, eventTypes); diff != "" {
+				t.Errorf("ListCreateEventTypes() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListOptionalOrgResourcesBoundsCreateEvents(t *testing.T) {
+	auditEvents := &mockAuditEvents{}
+	now := time.Date(2024, 6, 30, 15, 0, 0, 0, time.UTC)
+	opts := Options{
+		PurgeDays:          30,
+		ClockSource:        clockSourceAuditEvents,
+		FirstResourceTypes: []string{resourceTypeApps},
+	}
+
+	err := listOptionalOrgResources(context.Background(), &cfResourceClient{AuditEvents: auditEvents}, &resource.Organization{}, opts, now, &orgResources{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := client.TimestampFilter{
+		Timestamp: []time.Time{time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC)},
+		Operator:  client.FilterModifierGreaterThanOrEqual,
+	}
+	if diff := cmp.Diff(expected, auditEvents.opts.CreateAts); diff != "" {
+		t.Errorf("unexpected created at filter (-expected +got):\n%s", diff)
+	}
+}
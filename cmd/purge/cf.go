@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/cloudfoundry-community/go-cfclient/v3/client"
 	"github.com/cloudfoundry-community/go-cfclient/v3/config"
@@ -10,14 +11,27 @@ import (
 
 type ApplicationsClient interface {
 	Delete(ctx context.Context, guid string) (string, error)
+	GetEnvironmentVariables(ctx context.Context, guid string) (map[string]*string, error)
 	ListAll(ctx context.Context, opts *client.AppListOptions) ([]*resource.App, error)
 }
 
+type AuditEventsClient interface {
+	ListAll(ctx context.Context, opts *client.AuditEventListOptions) ([]*resource.AuditEvent, error)
+}
+
+type OrganizationQuotasClient interface {
+	Single(ctx context.Context, opts *client.OrganizationQuotaListOptions) (*resource.OrganizationQuota, error)
+}
+
 type OrganizationsClient interface {
 	ListAll(ctx context.Context, opts *client.OrganizationListOptions) ([]*resource.Organization, error)
 	Single(ctx context.Context, opts *client.OrganizationListOptions) (*resource.Organization, error)
 }
 
+type ProcessesClient interface {
+	ListForAppAll(ctx context.Context, appGUID string, opts *client.ProcessListOptions) ([]*resource.Process, error)
+}
+
 type RolesClient interface {
 	CreateSpaceRole(ctx context.Context, spaceGUID, userGUID string, roleType resource.SpaceRoleType) (*resource.Role, error)
 	ListIncludeUsersAll(ctx context.Context, opts *client.RoleListOptions) ([]*resource.Role, []*resource.User, error)
@@ -27,6 +41,27 @@ type ServiceInstancesClient interface {
 	ListAll(ctx context.Context, opts *client.ServiceInstanceListOptions) ([]*resource.ServiceInstance, error)
 }
 
+type RoutesClient interface {
+	Delete(ctx context.Context, guid string) (string, error)
+	ListAll(ctx context.Context, opts *client.RouteListOptions) ([]*resource.Route, error)
+}
+
+type ServicePlansClient interface {
+	ListIncludeServiceOfferingAll(ctx context.Context, opts *client.ServicePlanListOptions) ([]*resource.ServicePlan, []*resource.ServiceOffering, error)
+}
+
+type ServiceCredentialBindingsClient interface {
+	ListAll(ctx context.Context, opts *client.ServiceCredentialBindingListOptions) ([]*resource.ServiceCredentialBinding, error)
+}
+
+type TasksClient interface {
+	ListAll(ctx context.Context, opts *client.TaskListOptions) ([]*resource.Task, error)
+}
+
+type PackagesClient interface {
+	ListForAppAll(ctx context.Context, appGUID string, opts *client.PackageListOptions) ([]*resource.Package, error)
+}
+
 type SpacesClient interface {
 	ListAll(ctx context.Context, opts *client.SpaceListOptions) ([]*resource.Space, error)
 	ListUsersAll(ctx context.Context, spaceGUID string, opts *client.UserListOptions) ([]*resource.User, error)
@@ -45,18 +80,54 @@ type UsersClient interface {
 }
 
 type JobsClient interface {
+	Get(ctx context.Context, guid string) (*resource.Job, error)
 	PollComplete(ctx context.Context, jobGUID string, opts *client.PollingOptions) error
 }
 
 type cfResourceClient struct {
-	Applications     ApplicationsClient
-	Organizations    OrganizationsClient
-	Roles            RolesClient
-	ServiceInstances ServiceInstancesClient
-	Spaces           SpacesClient
-	SpaceQuotas      SpaceQuotasClient
-	Users            UsersClient
-	Jobs             JobsClient
+	Applications              ApplicationsClient
+	AuditEvents               AuditEventsClient
+	Organizations             OrganizationsClient
+	OrganizationQuotas        OrganizationQuotasClient
+	Packages                  PackagesClient
+	Processes                 ProcessesClient
+	Roles                     RolesClient
+	Routes                    RoutesClient
+	ServiceCredentialBindings ServiceCredentialBindingsClient
+	ServiceInstances          ServiceInstancesClient
+	ServicePlans              ServicePlansClient
+	Spaces                    SpacesClient
+	SpaceQuotas               SpaceQuotasClient
+	Tasks                     TasksClient
+	Users                     UsersClient
+	Jobs                      JobsClient
+}
+
+// newRetryingCFClient builds a client from opts whose calls are retried
+// according to RETRY_ATTEMPTS and RETRY_BASE_DELAY; building it looks up the
+// auth endpoint from the API root, so that is retried too
+func newRetryingCFClient(opts Options) (*cfResourceClient, error) {
+	policy := newRetryPolicy(opts)
+	cfClient, err := retryValue(context.Background(), policy, "create client", func(int) (*cfResourceClient, error) {
+		cfClient, err := newCFClient(opts.APIAddress, opts.ClientID, opts.ClientSecret)
+		return cfClient, apiRootError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withRetries(cfClient, policy), nil
+}
+
+// apiRootError turns go-cfclient's plain error for a failed API root request
+// back into a CloudFoundryHTTPError, so a 5xx there can be retried
+func apiRootError(err error) error {
+	var status int
+	if err != nil {
+		if _, scanErr := fmt.Sscanf(err.Error(), "error getting global API root, got status code %d", &status); scanErr == nil {
+			return client.CloudFoundryHTTPError{StatusCode: status, Status: err.Error()}
+		}
+	}
+	return err
 }
 
 func newCFClient(
@@ -77,13 +148,21 @@ func newCFClient(
 		return nil, err
 	}
 	return &cfResourceClient{
-		Applications:     cf.Applications,
-		Organizations:    cf.Organizations,
-		Roles:            cf.Roles,
-		ServiceInstances: cf.ServiceInstances,
-		Spaces:           cf.Spaces,
-		SpaceQuotas:      cf.SpaceQuotas,
-		Users:            cf.Users,
-		Jobs:             cf.Jobs,
+		Applications:              cf.Applications,
+		AuditEvents:               cf.AuditEvents,
+		Organizations:             cf.Organizations,
+		OrganizationQuotas:        cf.OrganizationQuotas,
+		Packages:                  cf.Packages,
+		Processes:                 cf.Processes,
+		Roles:                     cf.Roles,
+		Routes:                    cf.Routes,
+		ServiceCredentialBindings: cf.ServiceCredentialBindings,
+		ServiceInstances:          cf.ServiceInstances,
+		ServicePlans:              cf.ServicePlans,
+		Spaces:                    cf.Spaces,
+		SpaceQuotas:               cf.SpaceQuotas,
+		Tasks:                     cf.Tasks,
+		Users:                     cf.Users,
+		Jobs:                      cf.Jobs,
 	}, nil
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+const (
+	commandRun       = "run"
+	commandPlan      = "plan"
+	commandApply     = "apply"
+	commandNotify    = "notify"
+	commandPurge     = "purge"
+	commandExplain   = "explain"
+	commandPreflight = "preflight"
+	commandDecrypt   = "decrypt"
+	commandServe     = "serve"
+
+	commandConfigValidate = "config validate"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+var commandUsage = map[string]string{
+	commandRun:       "notify and purge sandboxes in a single pass (default)",
+	commandPlan:      "write the planned actions to a file: plan <file>",
+	commandApply:     "apply the actions in a plan file: apply <file>",
+	commandNotify:    "only send reminders",
+	commandPurge:     "only purge sandboxes and delete orphaned routes",
+	commandExplain:   "explain the timeline for one space: explain [--foundation <name>] --org <org> --space <space> [--format json]",
+	commandPreflight: "check configuration, credentials and quotas without changing anything",
+	commandServe:     "run notify and purge on NOTIFY_SCHEDULE and PURGE_SCHEDULE, serving /healthz, /status and /metrics on PORT",
+	commandDecrypt:   "decrypt an export or plan file: decrypt --identity <key file> [--output <file>] <file>",
+
+	commandConfigValidate: "check options, the policy file and encryption keys without connecting to the platform",
+}
+
+// optionFlag describes a command line flag that overrides an Options env var;
+// secrets are left out so they don't show up in process listings
+type optionFlag struct {
+	env    string
+	isBool bool
+}
+
+var optionFlags = []optionFlag{
+	{env: "API_ADDRESS"},
+	{env: "CLIENT_ID"},
+	{env: "CLIENT_SECRET_FILE"},
+	{env: "ORG_PREFIX"},
+	{env: "ORG_LABEL_SELECTOR"},
+	{env: "ORG_QUOTA_NAME"},
+	{env: "ORG_INCLUDE"},
+	{env: "ORG_EXCLUDE"},
+	{env: "NOTIFY_DAYS"},
+	{env: "NOTIFY_STAGES"},
+	{env: "PURGE_DAYS"},
+	{env: "ORPHANED_ROUTE_DAYS"},
+	{env: "DRY_RUN", isBool: true},
+	{env: "DISABLE_PURGE", isBool: true},
+	{env: "TIME_STARTS_AT"},
+	{env: "SANDBOX_QUOTA_NAME"},
+	{env: "POLICY_FILE"},
+	{env: "FOUNDATIONS_FILE"},
+	{env: "LEDGER_FILE"},
+	{env: "SNAPSHOT_DIR"},
+	{env: "EXPORT_DIR"},
+	{env: "DELETE_TIMEOUT"},
+	{env: "DELETE_POLL_INTERVAL"},
+	{env: "DELETE_ASYNC", isBool: true},
+	{env: "ENCRYPT_RECIPIENTS"},
+	{env: "DECRYPT_IDENTITY_FILE"},
+	{env: "FIRST_RESOURCE_TYPES"},
+	{env: "CLOCK_SOURCE"},
+	{env: "CONCURRENCY"},
+	{env: "RETRY_ATTEMPTS"},
+	{env: "RETRY_BASE_DELAY"},
+	{env: "MAX_PURGES_PER_RUN"},
+	{env: "MAX_PURGES_PER_ORG"},
+	{env: "MAX_PURGE_PERCENT"},
+	{env: "ALLOW_MASS_PURGE", isBool: true},
+	{env: "NOTIFY_SCHEDULE"},
+	{env: "PURGE_SCHEDULE"},
+	{env: "PORT"},
+	{env: "METRICS_FILE"},
+	{env: "LOG_FORMAT"},
+	{env: "LOG_LEVEL"},
+	{env: "LOG_REDACT"},
+	{env: "MAIL_SENDER"},
+	{env: "SMTP_HOST"},
+	{env: "SMTP_PORT"},
+	{env: "SMTP_PASS_FILE"},
+	{env: "SMTP_CERT_FILE"},
+}
+
+// flagName converts an env var name to its flag name, e.g. DRY_RUN to dry-run
+func flagName(env string) string {
+	return strings.ToLower(strings.ReplaceAll(env, "_", "-"))
+}
+
+// cliCommand describes a parsed command line
+type cliCommand struct {
+	Name      string
+	PlanFile  string
+	Org       string
+	Space     string
+	Format    string
+	Overrides map[string]string
+
+	// Foundation picks a foundation from FOUNDATIONS_FILE for explain
+	Foundation string
+
+	// ConfigFile overrides CONFIG_FILE
+	ConfigFile string
+
+	// set for decrypt
+	InputFile    string
+	IdentityFile string
+	OutputFile   string
+}
+
+// parseCommand parses a subcommand and its flags; with no subcommand, run is
+// assumed
+func parseCommand(args []string, output io.Writer) (cliCommand, error) {
+	cmd := cliCommand{Name: commandRun, Overrides: map[string]string{}}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd.Name, args = args[0], args[1:]
+	}
+	if cmd.Name == "config" && len(args) > 0 && args[0] == "validate" {
+		cmd.Name, args = commandConfigValidate, args[1:]
+	}
+	if _, ok := commandUsage[cmd.Name]; !ok {
+		return cmd, fmt.Errorf("unknown command %q; expected one of %s", cmd.Name, strings.Join(listCommands(), ", "))
+	}
+
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "usage: purge %s [flags]\n  %s\n\nflags override the matching env vars:\n", cmd.Name, commandUsage[cmd.Name])
+		fs.PrintDefaults()
+	}
+	for _, option := range optionFlags {
+		if cmd.Name == commandDecrypt {
+			// decrypt runs offline and reads no other options
+			break
+		}
+		env := option.env
+		set := func(value string) error {
+			cmd.Overrides[env] = value
+			return nil
+		}
+		usage := fmt.Sprintf("overrides %s", env)
+		if option.isBool {
+			fs.BoolFunc(flagName(env), usage, set)
+		} else {
+			fs.Func(flagName(env), usage, set)
+		}
+	}
+	if cmd.Name != commandDecrypt {
+		fs.StringVar(&cmd.ConfigFile, "config", "", "YAML or JSON file with option values; overrides CONFIG_FILE")
+	}
+	if cmd.Name == commandExplain {
+		fs.StringVar(&cmd.Foundation, "foundation", "", "name of the foundation to explain, required with FOUNDATIONS_FILE")
+		fs.StringVar(&cmd.Org, "org", "", "name of the org to explain")
+		fs.StringVar(&cmd.Space, "space", "", "name of the space to explain")
+		fs.StringVar(&cmd.Format, "format", formatText, "output format: text or json")
+	}
+	if cmd.Name == commandDecrypt {
+		fs.StringVar(&cmd.IdentityFile, "identity", "", "file with the age private key")
+		fs.StringVar(&cmd.OutputFile, "output", "", "file to write to instead of stdout")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cmd, err
+	}
+
+	switch cmd.Name {
+	case commandPlan, commandApply:
+		if fs.NArg() != 1 {
+			return cmd, fmt.Errorf("%s requires a plan file", cmd.Name)
+		}
+		cmd.PlanFile = fs.Arg(0)
+	case commandDecrypt:
+		if fs.NArg() != 1 {
+			return cmd, errors.New("decrypt requires a file")
+		}
+		if cmd.IdentityFile == "" {
+			return cmd, errors.New("decrypt requires --identity")
+		}
+		cmd.InputFile = fs.Arg(0)
+	case commandExplain:
+		if cmd.Org == "" || cmd.Space == "" {
+			return cmd, errors.New("explain requires --org and --space")
+		}
+		if cmd.Format != formatText && cmd.Format != formatJSON {
+			return cmd, fmt.Errorf("unknown format %q; expected %s or %s", cmd.Format, formatText, formatJSON)
+		}
+		fallthrough
+	default:
+		if fs.NArg() != 0 {
+			return cmd, fmt.Errorf("unexpected arguments for %s: %s", cmd.Name, strings.Join(fs.Args(), " "))
+		}
+	}
+	return cmd, nil
+}
+
+func listCommands() []string {
+	return []string{
+		commandRun,
+		commandPlan,
+		commandApply,
+		commandNotify,
+		commandPurge,
+		commandExplain,
+		commandPreflight,
+		commandServe,
+		commandDecrypt,
+		commandConfigValidate,
+	}
+}
+
+// processOptions reads Options from the environment, preferring command line
+// overrides and falling back to values from the config file; every missing
+// required option and every value that can't be parsed is reported at once
+func processOptions(ctx context.Context, overrides map[string]string, env envconfig.Lookuper, config map[string]string) (Options, error) {
+	lookuper := &optionLookuper{
+		next:    envconfig.MultiLookuper(envconfig.MapLookuper(overrides), env, envconfig.MapLookuper(config)),
+		skipped: map[string]bool{},
+	}
+
+	var problems []error
+	required := map[string]bool{}
+	for _, spec := range listOptionSpecs() {
+		required[spec.env] = spec.required
+		if value, ok := lookuper.next.Lookup(spec.env); spec.required && (!ok || value == "") {
+			problems = append(problems, fmt.Errorf("missing required option %s", spec.env))
+			lookuper.skipped[spec.env] = true
+		}
+	}
+
+	// envconfig stops at the first value it can't parse, so leave that value
+	// out and try again until the rest parse
+	var opts Options
+	for {
+		opts = Options{}
+		lookuper.lastKey = ""
+		err := envconfig.ProcessWith(ctx, &envconfig.Config{
+			Target:   &opts,
+			Lookuper: lookuper,
+		})
+		if err == nil {
+			break
+		}
+		key := lookuper.lastKey
+		if _, ok := lookuper.skipped[key]; ok || key == "" {
+			problems = append(problems, err)
+			break
+		}
+		problems = append(problems, fmt.Errorf("invalid value for %s: %w", key, err))
+		lookuper.skipped[key] = required[key]
+	}
+	return opts, errors.Join(problems...)
+}
+
+// optionLookuper leaves out skipped options, reporting required ones as set
+// but empty so envconfig doesn't stop on them, and remembers the last key
+// looked up so a parse error can be traced to its option
+type optionLookuper struct {
+	next    envconfig.Lookuper
+	skipped map[string]bool
+	lastKey string
+}
+
+func (l *optionLookuper) Lookup(key string) (string, bool) {
+	l.lastKey = key
+	if found, ok := l.skipped[key]; ok {
+		return "", found
+	}
+	return l.next.Lookup(key)
+}
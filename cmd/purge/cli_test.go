@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sethvargo/go-envconfig"
+)
+
+func TestParseCommand(t *testing.T) {
+	testCases := map[string]struct {
+		args          []string
+		expected      cliCommand
+		expectedError bool
+	}{
+		"defaults to run": {
+			args:     []string{},
+			expected: cliCommand{Name: commandRun, Overrides: map[string]string{}},
+		},
+		"run with flags": {
+			args: []string{"--dry-run", "--purge-days", "60"},
+			expected: cliCommand{
+				Name:      commandRun,
+				Overrides: map[string]string{"DRY_RUN": "true", "PURGE_DAYS": "60"},
+			},
+		},
+		"plan with file": {
+			args: []string{"plan", "--dry-run=false", "plan.json"},
+			expected: cliCommand{
+				Name:      commandPlan,
+				PlanFile:  "plan.json",
+				Overrides: map[string]string{"DRY_RUN": "false"},
+			},
+		},
+		"plan without file": {
+			args:          []string{"plan"},
+			expectedError: true,
+		},
+		"config validate": {
+			args: []string{"config", "validate", "--config", "purge.yml", "--purge-days", "60"},
+			expected: cliCommand{
+				Name:       commandConfigValidate,
+				ConfigFile: "purge.yml",
+				Overrides:  map[string]string{"PURGE_DAYS": "60"},
+			},
+		},
+		"config without validate": {
+			args:          []string{"config"},
+			expectedError: true,
+		},
+		"explain": {
+			args: []string{"explain", "--org", "sandbox-gsa", "--space", "jane.doe"},
+			expected: cliCommand{
+				Name:      commandExplain,
+				Org:       "sandbox-gsa",
+				Space:     "jane.doe",
+				Format:    formatText,
+				Overrides: map[string]string{},
+			},
+		},
+		"explain a foundation": {
+			args: []string{"explain", "--foundation", "east", "--org", "sandbox-gsa", "--space", "jane.doe"},
+			expected: cliCommand{
+				Name:       commandExplain,
+				Foundation: "east",
+				Org:        "sandbox-gsa",
+				Space:      "jane.doe",
+				Format:     formatText,
+				Overrides:  map[string]string{},
+			},
+		},
+		"explain as json": {
+			args: []string{"explain", "--org", "sandbox-gsa", "--space", "jane.doe", "--format", "json"},
+			expected: cliCommand{
+				Name:      commandExplain,
+				Org:       "sandbox-gsa",
+				Space:     "jane.doe",
+				Format:    formatJSON,
+				Overrides: map[string]string{},
+			},
+		},
+		"explain with unknown format": {
+			args:          []string{"explain", "--org", "sandbox-gsa", "--space", "jane.doe", "--format", "yaml"},
+			expectedError: true,
+		},
+		"explain without space": {
+			args:          []string{"explain", "--org", "sandbox-gsa"},
+			expectedError: true,
+		},
+		"org flag only applies to explain": {
+			args:          []string{"notify", "--org", "sandbox-gsa"},
+			expectedError: true,
+		},
+		"secrets are not flags": {
+			args:          []string{"run", "--client-secret", "secret"},
+			expectedError: true,
+		},
+		"decrypt": {
+			args: []string{"decrypt", "--identity", "key.txt", "--output", "export.tar.gz", "export.tar.gz.age"},
+			expected: cliCommand{
+				Name:         commandDecrypt,
+				Overrides:    map[string]string{},
+				InputFile:    "export.tar.gz.age",
+				IdentityFile: "key.txt",
+				OutputFile:   "export.tar.gz",
+			},
+		},
+		"decrypt without identity": {
+			args:          []string{"decrypt", "export.tar.gz.age"},
+			expectedError: true,
+		},
+		"unknown command": {
+			args:          []string{"destroy"},
+			expectedError: true,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cmd, err := parseCommand(test.args, io.Discard)
+			if test.expectedError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(test.expected, cmd); diff != "" {
+				t.Errorf("command mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProcessOptionsOverrides(t *testing.T) {
+	env := envconfig.MapLookuper(map[string]string{
+		"API_ADDRESS":         "https://api.example.gov",
+		"CLIENT_ID":           "client",
+		"CLIENT_SECRET":       "secret",
+		"ORG_PREFIX":          "sandbox",
+		"PURGE_DAYS":          "30",
+		"MAIL_SENDER":         "no-reply@example.gov",
+		"NOTIFY_MAIL_SUBJECT": "notify",
+		"PURGE_MAIL_SUBJECT":  "purge",
+		"SANDBOX_QUOTA_NAME":  "sandbox",
+		"SMTP_HOST":           "smtp.example.gov",
+		"SMTP_USER":           "user",
+		"SMTP_PASS":           "pass",
+	})
+
+	opts, err := processOptions(context.Background(), map[string]string{
+		"PURGE_DAYS": "60",
+		"DRY_RUN":    "false",
+	}, env, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if opts.PurgeDays != 60 {
+		t.Errorf("expected flag to override PURGE_DAYS, got %d", opts.PurgeDays)
+	}
+	if opts.DryRun {
+		t.Error("expected flag to override DRY_RUN")
+	}
+	if opts.OrgPrefix != "sandbox" {
+		t.Errorf("expected ORG_PREFIX from env, got %s", opts.OrgPrefix)
+	}
+}
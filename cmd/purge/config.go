@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sethvargo/go-envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// optionSpec describes an Options field set by an env var
+type optionSpec struct {
+	env      string
+	required bool
+}
+
+// listOptionSpecs returns the env vars read into Options, including the
+// embedded SMTPOptions
+func listOptionSpecs() []optionSpec {
+	var specs []optionSpec
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type)
+				continue
+			}
+			tag, ok := field.Tag.Lookup("env")
+			if !ok {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			spec := optionSpec{env: strings.TrimSpace(parts[0])}
+			for _, part := range parts[1:] {
+				if strings.TrimSpace(part) == "required" {
+					spec.required = true
+				}
+			}
+			specs = append(specs, spec)
+		}
+	}
+	walk(reflect.TypeOf(Options{}))
+	return specs
+}
+
+// readConfigFile reads option values from a YAML or JSON file keyed by env var
+// name, e.g. PURGE_DAYS or purge_days; lists are joined with commas as in the
+// env var. Values for unknown or nested keys are reported as errors, and the
+// rest are still returned so every problem can be reported at once.
+func readConfigFile(filename string) (map[string]string, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", filename, err)
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", filename, err)
+	}
+
+	known := map[string]bool{}
+	for _, spec := range listOptionSpecs() {
+		known[spec.env] = true
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := map[string]string{}
+	var problems []error
+	for _, key := range keys {
+		env := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if !known[env] {
+			problems = append(problems, fmt.Errorf("unknown option %s in config file %s", key, filename))
+			continue
+		}
+		value, err := configValue(raw[key])
+		if err != nil {
+			problems = append(problems, fmt.Errorf("error reading option %s in config file %s: %w", key, filename, err))
+			continue
+		}
+		values[env] = value
+	}
+	return values, errors.Join(problems...)
+}
+
+func configValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case []any, map[string]any:
+				return "", errors.New("list items must be values")
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", errors.New("expected a value or a list")
+	}
+	return fmt.Sprint(value), nil
+}
+
+// loadOptions reads Options from, in order of precedence, command line flags,
+// env vars and the config file named by --config or CONFIG_FILE, then
+// validates them; every problem found is reported at once
+func loadOptions(ctx context.Context, cmd cliCommand, env envconfig.Lookuper) (Options, error) {
+	var problems []error
+
+	configFile := cmd.ConfigFile
+	if configFile == "" {
+		configFile, _ = env.Lookup("CONFIG_FILE")
+	}
+	var config map[string]string
+	if configFile != "" {
+		var err error
+		config, err = readConfigFile(configFile)
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	opts, err := processOptions(ctx, cmd.Overrides, env, config)
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	if opts.FoundationsFile != "" {
+		opts.Foundations, err = loadFoundations(opts.FoundationsFile)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("error loading foundations: %w", err))
+		}
+	}
+
+	if err := checkSecretSources(opts); err != nil {
+		problems = append(problems, err)
+	} else if err := readSecretFiles(&opts); err != nil {
+		problems = append(problems, err)
+	}
+
+	if err := validateOptions(opts); err != nil {
+		problems = append(problems, err)
+	}
+	return opts, errors.Join(problems...)
+}
+
+// validateConfig checks everything that can be checked without connecting
+// to the platform: options, the policy file and encryption keys
+func validateConfig(ctx context.Context, cmd cliCommand, env envconfig.Lookuper) error {
+	opts, err := loadOptions(ctx, cmd, env)
+	problems := []error{err}
+
+	if opts.PolicyFile != "" {
+		policy, err := loadPolicy(opts.PolicyFile, opts)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("error loading policy: %w", err))
+		} else if policy.hasStages() && opts.LedgerFile == "" {
+			problems = append(problems, fmt.Errorf("error loading policy: %w", errStagesNeedLedger))
+		}
+	}
+	if _, err := newArtifactCipher(opts.EncryptRecipients, opts.DecryptIdentityFile); err != nil {
+		problems = append(problems, fmt.Errorf("error loading encryption keys: %w", err))
+	}
+	return errors.Join(problems...)
+}
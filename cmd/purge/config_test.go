@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sethvargo/go-envconfig"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	testCases := map[string]struct {
+		contents       string
+		expected       map[string]string
+		expectedErrors []string
+	}{
+		"yaml": {
+			contents: `
+PURGE_DAYS: 60
+notify_stages: [10, 3]
+dry-run: false
+mail_sender: no-reply@example.gov
+retry_base_delay: 2s
+`,
+			expected: map[string]string{
+				"PURGE_DAYS":       "60",
+				"NOTIFY_STAGES":    "10,3",
+				"DRY_RUN":          "false",
+				"MAIL_SENDER":      "no-reply@example.gov",
+				"RETRY_BASE_DELAY": "2s",
+			},
+		},
+		"json": {
+			contents: `{"PURGE_DAYS": 60, "MAX_PURGE_PERCENT": 12.5, "FIRST_RESOURCE_TYPES": ["apps", "routes"]}`,
+			expected: map[string]string{
+				"PURGE_DAYS":           "60",
+				"MAX_PURGE_PERCENT":    "12.5",
+				"FIRST_RESOURCE_TYPES": "apps,routes",
+			},
+		},
+		"unknown and nested keys": {
+			contents: `
+PURGE_DAYS: 60
+PURGE_DAZE: 60
+SMTP:
+  HOST: smtp.example.gov
+`,
+			expected: map[string]string{"PURGE_DAYS": "60"},
+			expectedErrors: []string{
+				"unknown option PURGE_DAZE",
+				"unknown option SMTP",
+			},
+		},
+		"nested list": {
+			contents:       `NOTIFY_STAGES: [[10], 3]`,
+			expected:       map[string]string{},
+			expectedErrors: []string{"error reading option NOTIFY_STAGES"},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(filename, []byte(test.contents), 0o600); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			got, err := readConfigFile(filename)
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("unexpected values (-expected +got):\n%s", diff)
+			}
+			checkProblems(t, err, test.expectedErrors)
+		})
+	}
+}
+
+func TestLoadOptions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	contents := `
+API_ADDRESS: https://api.example.gov
+CLIENT_ID: client
+ORG_PREFIX: sandbox
+MAIL_SENDER: no-reply@example.gov
+NOTIFY_MAIL_SUBJECT: notify
+PURGE_MAIL_SUBJECT: purge
+SANDBOX_QUOTA_NAME: sandbox
+SMTP_HOST: smtp.example.gov
+SMTP_USER: user
+PURGE_DAYS: 40
+NOTIFY_DAYS: 20
+CONCURRENCY: 2
+`
+	if err := os.WriteFile(filename, []byte(contents), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	env := envconfig.MapLookuper(map[string]string{
+		"CONFIG_FILE":   filename,
+		"CLIENT_SECRET": "secret",
+		"SMTP_PASS":     "pass",
+		"NOTIFY_DAYS":   "25",
+		"CONCURRENCY":   "4",
+	})
+	cmd := cliCommand{Name: commandRun, Overrides: map[string]string{"CONCURRENCY": "8"}}
+
+	opts, err := loadOptions(context.Background(), cmd, env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if opts.PurgeDays != 40 {
+		t.Errorf("expected PURGE_DAYS from config file, got %d", opts.PurgeDays)
+	}
+	if opts.NotifyDays != 25 {
+		t.Errorf("expected env to override NOTIFY_DAYS, got %d", opts.NotifyDays)
+	}
+	if opts.Concurrency != 8 {
+		t.Errorf("expected flag to override CONCURRENCY, got %d", opts.Concurrency)
+	}
+	if opts.SMTPPort != 587 {
+		t.Errorf("expected default SMTP_PORT, got %d", opts.SMTPPort)
+	}
+	if opts.MaxPurgesPerRun != 100 || opts.MaxPurgePercent != 25 {
+		t.Errorf("expected default purge limits, got %d spaces and %g%%", opts.MaxPurgesPerRun, opts.MaxPurgePercent)
+	}
+
+	_, err = loadOptions(context.Background(), cliCommand{Name: commandRun, ConfigFile: filename}, envconfig.MapLookuper(nil))
+	checkProblems(t, err, []string{
+		"CLIENT_SECRET or CLIENT_SECRET_FILE is required",
+		"SMTP_PASS or SMTP_PASS_FILE is required",
+	})
+
+	// A missing option doesn't hide the other problems
+	_, err = loadOptions(context.Background(), cliCommand{Name: commandRun, ConfigFile: filename}, envconfig.MapLookuper(map[string]string{
+		"CLIENT_SECRET": "secret",
+		"SMTP_PASS":     "pass",
+		"MAIL_SENDER":   "",
+		"NOTIFY_DAYS":   "45",
+		"CONCURRENCY":   "0",
+	}))
+	checkProblems(t, err, []string{
+		"missing required option MAIL_SENDER",
+		"NOTIFY_DAYS (45) must be less than PURGE_DAYS (40)",
+		"concurrency must be at least 1, got 0",
+	})
+
+	// Nor does a value that can't be parsed
+	_, err = loadOptions(context.Background(), cliCommand{Name: commandRun, ConfigFile: filename}, envconfig.MapLookuper(map[string]string{
+		"CLIENT_SECRET": "secret",
+		"SMTP_PASS":     "pass",
+		"PURGE_DAYS":    "abc",
+		"CONCURRENCY":   "x",
+	}))
+	checkProblems(t, err, []string{
+		`invalid value for PURGE_DAYS: PurgeDays("abc")`,
+		`invalid value for CONCURRENCY: Concurrency("x")`,
+	})
+}
+
+func TestValidateOptions(t *testing.T) {
+	valid := Options{
+		APIAddress:         "https://api.example.gov",
+		ClientID:           "client",
+		ClientSecret:       "secret",
+		OrgPrefix:          "sandbox",
+		SandboxQuotaName:   "sandbox",
+		PurgeDays:          30,
+		NotifyDays:         25,
+		MailSender:         "no-reply@example.gov",
+		FirstResourceTypes: []string{"apps"},
+		ClockSource:        "resources",
+		DeleteTimeout:      1,
+		DeletePollInterval: 1,
+		RetryAttempts:      1,
+		Concurrency:        1,
+		Port:               8080,
+		LogFormat:          logFormatJSON,
+		LogLevel:           "info",
+		LogRedact:          redactMask,
+		SMTPOptions:        SMTPOptions{SMTPPort: 587, SMTPPass: "pass"},
+	}
+	if err := validateOptions(valid); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	invalid := valid
+	invalid.NotifyDays = 30
+	invalid.MailSender = "no-reply"
+	invalid.Concurrency = 0
+	invalid.LogFormat = "xml"
+	checkProblems(t, validateOptions(invalid), []string{
+		"NOTIFY_DAYS (30) must be less than PURGE_DAYS (30)",
+		`MAIL_SENDER "no-reply" is not a valid email address`,
+		"concurrency must be at least 1, got 0",
+		`unknown log format "xml"`,
+	})
+
+	staged := valid
+	staged.NotifyStageDays = []int{7, 2, 1}
+	checkProblems(t, validateOptions(staged), []string{
+		"notify stages need LEDGER_FILE so each stage is sent once",
+	})
+	staged.LedgerFile = "ledger.json"
+	checkProblems(t, validateOptions(staged), nil)
+
+	encrypted := valid
+	encrypted.SnapshotDir = "snapshots"
+	encrypted.EncryptRecipients = []string{"age1example"}
+	checkProblems(t, validateOptions(encrypted), []string{
+		"SNAPSHOT_DIR with ENCRYPT_RECIPIENTS requires DECRYPT_IDENTITY_FILE to read snapshots back",
+	})
+	encrypted.DecryptIdentityFile = "identity.txt"
+	checkProblems(t, validateOptions(encrypted), nil)
+}
+
+// checkProblems checks that err reports each of the expected problems, one
+// per line
+func checkProblems(t *testing.T, err error, expected []string) {
+	t.Helper()
+	if len(expected) == 0 {
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("expected errors %q", expected)
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != len(expected) {
+		t.Errorf("expected %d problems, got %d:\n%s", len(expected), len(lines), err)
+	}
+	for _, problem := range expected {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected error to contain %q, got:\n%s", problem, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// ageHeader starts every file encrypted by age
+const ageHeader = "age-encryption.org/v1\n"
+
+var ErrEncryptedNoIdentity = errors.New("file is encrypted; set DECRYPT_IDENTITY_FILE to read it")
+
+// artifactCipher encrypts the files the job leaves behind for people to read
+// later, such as exports and plan files; a nil cipher leaves them in plaintext
+type artifactCipher struct {
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+// newArtifactCipher parses age public keys and, if set, an identity file used
+// to read encrypted files back; it returns nil if neither is configured
+func newArtifactCipher(recipients []string, identityFile string) (*artifactCipher, error) {
+	if len(recipients) == 0 && identityFile == "" {
+		return nil, nil
+	}
+	c := &artifactCipher{}
+	for _, recipient := range recipients {
+		parsed, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing recipient %q: %w", recipient, err)
+		}
+		c.recipients = append(c.recipients, parsed)
+	}
+	if identityFile != "" {
+		identities, err := loadIdentities(identityFile)
+		if err != nil {
+			return nil, err
+		}
+		c.identities = identities
+	}
+	return c, nil
+}
+
+// loadIdentities reads age private keys from a file
+func loadIdentities(filename string) ([]age.Identity, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading identity file %s: %w", filename, err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing identity file %s: %w", filename, err)
+	}
+	return identities, nil
+}
+
+// encrypts reports whether files written through the cipher are encrypted
+func (c *artifactCipher) encrypts() bool {
+	return c != nil && len(c.recipients) > 0
+}
+
+// extension returns the suffix to add to encrypted file names
+func (c *artifactCipher) extension() string {
+	if c.encrypts() {
+		return ".age"
+	}
+	return ""
+}
+
+// wrap returns a writer that encrypts to w; callers must close it to flush
+// the last chunk
+func (c *artifactCipher) wrap(w io.Writer) (io.WriteCloser, error) {
+	if !c.encrypts() {
+		return nopWriteCloser{w}, nil
+	}
+	return age.Encrypt(w, c.recipients...)
+}
+
+// encrypt encrypts data, or returns it unchanged if no recipients are set
+func (c *artifactCipher) encrypt(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.wrap(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decrypt decrypts data encrypted by age; plaintext is returned unchanged so
+// files written before encryption was configured can still be read
+func (c *artifactCipher) decrypt(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(ageHeader)) {
+		return data, nil
+	}
+	if c == nil || len(c.identities) == 0 {
+		return nil, ErrEncryptedNoIdentity
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), c.identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// decryptFile decrypts a file for support staff, writing to output
+func decryptFile(identityFile string, filename string, output io.Writer) error {
+	identities, err := loadIdentities(identityFile)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", filename, err)
+	}
+	plaintext, err := (&artifactCipher{identities: identities}).decrypt(data)
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %w", filename, err)
+	}
+	_, err = output.Write(plaintext)
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
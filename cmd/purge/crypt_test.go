@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func newTestIdentity(t *testing.T) (*age.X25519Identity, string) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return identity, identityFile
+}
+
+func TestEncryptedPlan(t *testing.T) {
+	identity, identityFile := newTestIdentity(t)
+	recipients := []string{identity.Recipient().String()}
+	filename := filepath.Join(t.TempDir(), "plan.json")
+	plan := newTestPlan(nil)
+
+	writer, err := newArtifactCipher(recipients, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := writePlan(filename, plan, writer); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.HasPrefix(contents, []byte(ageHeader)) {
+		t.Errorf("expected plan file to be encrypted")
+	}
+
+	if _, err := readPlan(filename, nil); !errors.Is(err, ErrEncryptedNoIdentity) {
+		t.Errorf("expected ErrEncryptedNoIdentity, got %v", err)
+	}
+
+	reader, err := newArtifactCipher(recipients, identityFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	saved, err := readPlan(filename, reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if drift := checkPlanDrift(saved, plan); len(drift) > 0 {
+		t.Errorf("expected saved plan to match, got drift: %v", drift)
+	}
+
+	var decrypted bytes.Buffer
+	if err := decryptFile(identityFile, filename, &decrypted); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.HasPrefix(decrypted.Bytes(), []byte("{")) {
+		t.Errorf("expected decrypted plan JSON, got %q", decrypted.String())
+	}
+}
+
+func TestNewArtifactCipher(t *testing.T) {
+	cipher, err := newArtifactCipher(nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cipher.encrypts() {
+		t.Errorf("expected no encryption without recipients")
+	}
+
+	if _, err := newArtifactCipher([]string{"not-a-key"}, ""); err == nil {
+		t.Errorf("expected error for invalid recipient")
+	}
+}
+
+func TestEncryptedSnapshots(t *testing.T) {
+	identity, identityFile := newTestIdentity(t)
+	cipher, err := newArtifactCipher([]string{identity.Recipient().String()}, identityFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dir := t.TempDir()
+	snapshots, err := newSnapshotStore(dir, cipher)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	snapshot := newTestSnapshot()
+	if err := snapshots.save(snapshot); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	contents, err := os.ReadFile(snapshots.filename(snapshot.Space.GUID))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.HasPrefix(contents, []byte(ageHeader)) || bytes.Contains(contents, []byte("foo@bar.gov")) {
+		t.Errorf("expected snapshot to be encrypted")
+	}
+
+	saved, err := snapshots.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(saved) != 1 || saved[0].Space.GUID != snapshot.Space.GUID {
+		t.Errorf("expected to read the snapshot back, got %v", saved)
+	}
+
+	// Without the identity, encrypted snapshots can't be read back
+	unreadable, err := newSnapshotStore(dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := unreadable.list(); !errors.Is(err, ErrEncryptedNoIdentity) {
+		t.Errorf("expected ErrEncryptedNoIdentity, got %v", err)
+	}
+}
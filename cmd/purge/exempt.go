@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+const (
+	exemptUntilKey   = "exempt-until"
+	exemptReasonKey  = "exempt-reason"
+	exemptDateLayout = "2006-01-02"
+)
+
+// exemption describes a metadata exemption from notify and purge
+type exemption struct {
+	Until  string    `json:"until"`
+	Ends   time.Time `json:"ends"`
+	Reason string    `json:"reason,omitempty"`
+	Source string    `json:"source"`
+}
+
+// getExemption reads the exemption date and reason from resource metadata,
+// preferring annotations over labels
+func getExemption(metadata *resource.Metadata) (*exemption, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+
+	until := getMetadataValue(metadata, exemptUntilKey)
+	if until == "" {
+		return nil, nil
+	}
+
+	ends, err := parseExemptUntil(until)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q: %w", exemptUntilKey, until, err)
+	}
+
+	return &exemption{
+		Until:  until,
+		Ends:   ends,
+		Reason: getMetadataValue(metadata, exemptReasonKey),
+	}, nil
+}
+
+// getMetadataValue returns the annotation for key, falling back to the label
+func getMetadataValue(metadata *resource.Metadata, key string) string {
+	if value, ok := metadata.Annotations[key]; ok && value != nil && *value != "" {
+		return *value
+	}
+	if value, ok := metadata.Labels[key]; ok && value != nil {
+		return *value
+	}
+	return ""
+}
+
+// parseExemptUntil parses an exemption date; a date without a time exempts
+// through the end of that day
+func parseExemptUntil(value string) (time.Time, error) {
+	if date, err := time.Parse(exemptDateLayout, value); err == nil {
+		return date.Add(24 * time.Hour), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// getSpaceExemption returns the active exemption for a space, checking the
+// space before its organization
+func getSpaceExemption(
+	org *resource.Organization,
+	space *resource.Space,
+	now time.Time,
+) (*exemption, error) {
+	exempt, err := getActiveExemption(space.Metadata, "space", now)
+	if err != nil || exempt != nil || org == nil {
+		return exempt, err
+	}
+	return getActiveExemption(org.Metadata, "org", now)
+}
+
+func getActiveExemption(metadata *resource.Metadata, source string, now time.Time) (*exemption, error) {
+	exempt, err := getExemption(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s exemption: %w", source, err)
+	}
+	if exempt == nil || !now.Before(exempt.Ends) {
+		return nil, nil
+	}
+	exempt.Source = source
+	return exempt, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetSpaceExemption(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		org               *resource.Organization
+		space             *resource.Space
+		expectedExemption *exemption
+		expectedErr       string
+	}{
+		"no metadata": {
+			space: &resource.Space{},
+		},
+		"space annotation through end of day": {
+			space: &resource.Space{
+				Metadata: resource.NewMetadata().
+					WithAnnotation("", exemptUntilKey, "2024-05-10").
+					WithAnnotation("", exemptReasonKey, "agency demo"),
+			},
+			expectedExemption: &exemption{
+				Until:  "2024-05-10",
+				Ends:   time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC),
+				Reason: "agency demo",
+				Source: "space",
+			},
+		},
+		"space annotation takes precedence over label": {
+			space: &resource.Space{
+				Metadata: resource.NewMetadata().
+					WithAnnotation("", exemptUntilKey, "2024-05-12").
+					WithLabel("", exemptUntilKey, "2024-05-11"),
+			},
+			expectedExemption: &exemption{
+				Until:  "2024-05-12",
+				Ends:   time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC),
+				Source: "space",
+			},
+		},
+		"org exemption applies to space": {
+			org: &resource.Organization{
+				Metadata: resource.NewMetadata().
+					WithLabel("", exemptUntilKey, "2024-05-20").
+					WithAnnotation("", exemptReasonKey, "pilot"),
+			},
+			space: &resource.Space{},
+			expectedExemption: &exemption{
+				Until:  "2024-05-20",
+				Ends:   time.Date(2024, 5, 21, 0, 0, 0, 0, time.UTC),
+				Reason: "pilot",
+				Source: "org",
+			},
+		},
+		"expired space exemption falls back to org": {
+			org: &resource.Organization{
+				Metadata: resource.NewMetadata().WithAnnotation("", exemptUntilKey, "2024-05-20T12:00:00Z"),
+			},
+			space: &resource.Space{
+				Metadata: resource.NewMetadata().WithAnnotation("", exemptUntilKey, "2024-05-09"),
+			},
+			expectedExemption: &exemption{
+				Until:  "2024-05-20T12:00:00Z",
+				Ends:   time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC),
+				Source: "org",
+			},
+		},
+		"expired exemption": {
+			space: &resource.Space{
+				Metadata: resource.NewMetadata().WithAnnotation("", exemptUntilKey, "2024-05-09"),
+			},
+		},
+		"invalid exemption date": {
+			space: &resource.Space{
+				Metadata: resource.NewMetadata().WithAnnotation("", exemptUntilKey, "soon"),
+			},
+			expectedErr: `error reading space exemption: invalid exempt-until value "soon": parsing time "soon" as "2006-01-02T15:04:05Z07:00": cannot parse "soon" as "2006"`,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			exempt, err := getSpaceExemption(test.org, test.space, now)
+			if (test.expectedErr == "" && err != nil) || (test.expectedErr != "" && test.expectedErr != err.Error()) {
+				t.Fatalf("expected error: %s, got: %s", test.expectedErr, err)
+			}
+			if diff := cmp.Diff(test.expectedExemption, exempt); diff != "" {
+				t.Errorf("GetSpaceExemption() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
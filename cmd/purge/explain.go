@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+// spaceExplanation describes the notify and purge timeline for a single space
+type spaceExplanation struct {
+	Org                 string          `json:"org"`
+	Space               string          `json:"space"`
+	SpaceGUID           string          `json:"space_guid"`
+	Profile             string          `json:"profile,omitempty"`
+	ResourceTypes       []string        `json:"resource_types"`
+	Resources           []spaceResource `json:"resources"`
+	FirstResource       time.Time       `json:"first_resource"`
+	TimeStartsAt        time.Time       `json:"time_starts_at"`
+	TimeStartsAtApplied bool            `json:"time_starts_at_applied"`
+	FirstResourceDay    time.Time       `json:"first_resource_day"`
+	Now                 time.Time       `json:"now"`
+	Days                int             `json:"days"`
+	NotifyDates         []stageDate     `json:"notify_dates"`
+	PurgeDays           int             `json:"purge_days"`
+	PurgeDate           time.Time       `json:"purge_date"`
+	PurgeDisabled       bool            `json:"purge_disabled"`
+	Exemption           *exemption      `json:"exemption,omitempty"`
+	ExemptionError      string          `json:"exemption_error,omitempty"`
+	Action              string          `json:"action"`
+	Stage               *NotifyStage    `json:"stage,omitempty"`
+}
+
+// stageDate describes the day a reminder stage is sent
+type stageDate struct {
+	Stage string    `json:"stage"`
+	Date  time.Time `json:"date"`
+}
+
+// explainSpace looks up a space and explains its notify and purge timeline
+func explainSpace(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	policy *Policy,
+	orgs []*resource.Organization,
+	orgName string,
+	spaceName string,
+	now time.Time,
+) (*spaceExplanation, error) {
+	var org *resource.Organization
+	for _, candidate := range orgs {
+		if candidate.Name == orgName {
+			org = candidate
+		}
+	}
+	if org == nil {
+		return nil, fmt.Errorf("org %s is not a sandbox org", orgName)
+	}
+
+	orgOpts, profile := policy.orgOptions(opts, org.Name)
+	resources, err := listOrgResources(ctx, cfClient, org, orgOpts, now)
+	if err != nil {
+		return nil, fmt.Errorf("error listing org resources: %w", err)
+	}
+
+	var space *resource.Space
+	for _, candidate := range resources.Spaces {
+		if candidate.Name == spaceName {
+			space = candidate
+		}
+	}
+	if space == nil {
+		return nil, fmt.Errorf("space %s not found", spaceName)
+	}
+
+	explanation, err := newSpaceExplanation(ctx, org, space, resources, orgOpts, now)
+	if err != nil {
+		return nil, err
+	}
+	if profile != nil {
+		explanation.Profile = profile.Name
+	}
+	return explanation, nil
+}
+
+// newSpaceExplanation builds the timeline for a space from its org's
+// resources, using the same decision as a full run
+func newSpaceExplanation(
+	ctx context.Context,
+	org *resource.Organization,
+	space *resource.Space,
+	resources orgResources,
+	opts Options,
+	now time.Time,
+) (*spaceExplanation, error) {
+	timeStartsAt, err := parseTimeStartsAt(opts.TimeStartsAt)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing time starts at: %w", err)
+	}
+
+	explanation := &spaceExplanation{
+		Org:           org.Name,
+		Space:         space.Name,
+		SpaceGUID:     space.GUID,
+		ResourceTypes: opts.FirstResourceTypes,
+		Resources:     listSpaceResources(space, resources, opts.FirstResourceTypes),
+		TimeStartsAt:  timeStartsAt,
+		Now:           now,
+		PurgeDays:     opts.PurgeDays,
+		PurgeDisabled: opts.DisablePurge,
+		Action:        "none",
+	}
+	sort.SliceStable(explanation.Resources, func(i, j int) bool {
+		return explanation.Resources[i].CreatedAt.Before(explanation.Resources[j].CreatedAt)
+	})
+
+	explanation.FirstResource, err = letFirstResource(space, resources, opts.FirstResourceTypes)
+	if err != nil {
+		return nil, fmt.Errorf("error getting first resource: %w", err)
+	}
+
+	explanation.Exemption, err = getSpaceExemption(org, space, now)
+	if err != nil {
+		explanation.ExemptionError = err.Error()
+	}
+
+	if explanation.FirstResource.IsZero() {
+		return explanation, nil
+	}
+
+	explanation.TimeStartsAtApplied = timeStartsAt.After(explanation.FirstResource)
+	explanation.FirstResourceDay, explanation.Days = getSpaceAge(explanation.FirstResource, timeStartsAt, now)
+	for _, stage := range listNotifyStages(opts) {
+		explanation.NotifyDates = append(explanation.NotifyDates, stageDate{
+			Stage: stage.Name,
+			Date:  explanation.FirstResourceDay.AddDate(0, 0, opts.PurgeDays-stage.DaysBeforePurge),
+		})
+	}
+	explanation.PurgeDate = explanation.FirstResourceDay.AddDate(0, 0, opts.PurgeDays)
+
+	spaceResources := resources
+	spaceResources.Spaces = []*resource.Space{space}
+	toNotify, toPurge, err := listPurgeSpaces(ctx, org, spaceResources, opts, now, timeStartsAt)
+	if err != nil {
+		return nil, fmt.Errorf("error listing spaces to purge: %w", err)
+	}
+	if len(toNotify) > 0 {
+		explanation.Action = actionNotify
+		explanation.Stage = toNotify[0].Stage
+	}
+	if len(toPurge) > 0 {
+		explanation.Action = actionPurge
+	}
+
+	return explanation, nil
+}
+
+// text renders an explanation for support staff
+func (e *spaceExplanation) text() string {
+	const dateLayout = "2006-01-02"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "space %s (%s) in org %s\n", e.Space, e.SpaceGUID, e.Org)
+	if e.Profile != "" {
+		fmt.Fprintf(&b, "policy profile: %s\n", e.Profile)
+	}
+
+	fmt.Fprintf(&b, "\nresources considered (%s):\n", strings.Join(e.ResourceTypes, ", "))
+	if len(e.Resources) == 0 {
+		fmt.Fprintf(&b, "  none\n")
+	}
+	for _, r := range e.Resources {
+		fmt.Fprintf(&b, "  %s  %s %s (%s)\n", r.CreatedAt.Format(time.RFC3339), r.Type, r.Name, r.GUID)
+	}
+
+	if e.FirstResource.IsZero() {
+		fmt.Fprintf(&b, "\nno resources count toward this space's age, so it will not be notified or purged\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "\nfirst resource:     %s\n", e.FirstResource.Format(time.RFC3339))
+	switch {
+	case e.TimeStartsAt.IsZero():
+		fmt.Fprintf(&b, "time starts at:     not set\n")
+	case e.TimeStartsAtApplied:
+		fmt.Fprintf(&b, "time starts at:     %s, after the first resource, so the clock starts then\n", e.TimeStartsAt.Format(time.RFC3339))
+	default:
+		fmt.Fprintf(&b, "time starts at:     %s, before the first resource, so it has no effect\n", e.TimeStartsAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "clock started:      %s\n", e.FirstResourceDay.Format(dateLayout))
+	fmt.Fprintf(&b, "today:              %s (%d days)\n", e.Now.Format(dateLayout), e.Days)
+	for _, notify := range e.NotifyDates {
+		fmt.Fprintf(&b, "%-20s%s\n", "notify "+notify.Stage+":", notify.Date.Format(dateLayout))
+	}
+	if e.PurgeDisabled {
+		fmt.Fprintf(&b, "purge:              disabled\n")
+	} else {
+		fmt.Fprintf(&b, "purge:              %s (after %d days)\n", e.PurgeDate.Format(dateLayout), e.PurgeDays)
+	}
+
+	if e.Exemption != nil {
+		fmt.Fprintf(&b, "exempt via %s metadata until %s: %s\n", e.Exemption.Source, e.Exemption.Until, e.Exemption.Reason)
+	}
+	if e.ExemptionError != "" {
+		fmt.Fprintf(&b, "skipped: %s\n", e.ExemptionError)
+	}
+
+	fmt.Fprintf(&b, "\naction today: %s", e.Action)
+	if e.Stage != nil {
+		fmt.Fprintf(&b, " (stage %s, %d days before purge)", e.Stage.Name, e.Stage.DaysBeforePurge)
+	}
+	fmt.Fprintf(&b, "\n")
+	return b.String()
+}
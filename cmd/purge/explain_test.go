@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewSpaceExplanation(t *testing.T) {
+	now := time.Date(2024, 7, 31, 0, 0, 0, 0, time.UTC)
+	org := &resource.Organization{Name: "sandbox-org"}
+	space := &resource.Space{GUID: "space-guid", Name: "space"}
+	resources := orgResources{
+		Spaces: []*resource.Space{space},
+		Apps: []*resource.App{
+			{
+				GUID: "app-guid",
+				Name: "app",
+				Relationships: resource.SpaceRelationship{
+					Space: resource.ToOneRelationship{
+						Data: &resource.Relationship{GUID: "space-guid"},
+					},
+				},
+				CreatedAt: now.Add(-20*24*time.Hour + time.Hour),
+			},
+		},
+		Instances: []*resource.ServiceInstance{
+			{
+				GUID: "instance-guid",
+				Name: "instance",
+				Relationships: resource.ServiceInstanceRelationships{
+					Space: &resource.ToOneRelationship{
+						Data: &resource.Relationship{GUID: "space-guid"},
+					},
+				},
+				CreatedAt: now.Add(-40 * 24 * time.Hour),
+			},
+		},
+	}
+	opts := Options{
+		NotifyDays:         25,
+		PurgeDays:          30,
+		FirstResourceTypes: resourceTypes,
+	}
+
+	testCases := map[string]struct {
+		timeStartsAt     string
+		expectedDay      time.Time
+		expectedDays     int
+		expectedAction   string
+		expectedApplied  bool
+		expectedInOutput string
+	}{
+		"purges from the first resource": {
+			expectedDay:      now.Add(-40 * 24 * time.Hour),
+			expectedDays:     40,
+			expectedAction:   actionPurge,
+			expectedInOutput: "time starts at:     not set",
+		},
+		"time starts at delays the clock": {
+			timeStartsAt:     now.Add(-25 * 24 * time.Hour).Format(time.RFC3339Nano),
+			expectedDay:      now.Add(-25 * 24 * time.Hour),
+			expectedDays:     25,
+			expectedAction:   actionNotify,
+			expectedApplied:  true,
+			expectedInOutput: "after the first resource, so the clock starts then",
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			opts := opts
+			opts.TimeStartsAt = test.timeStartsAt
+			explanation, err := newSpaceExplanation(context.Background(), org, space, resources, opts, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff([]string{"instance-guid", "app-guid"}, []string{explanation.Resources[0].GUID, explanation.Resources[1].GUID}); diff != "" {
+				t.Errorf("resources mismatch (-want +got):\n%s", diff)
+			}
+			if !explanation.FirstResourceDay.Equal(test.expectedDay) {
+				t.Errorf("expected first resource day %s, got %s", test.expectedDay, explanation.FirstResourceDay)
+			}
+			if explanation.Days != test.expectedDays {
+				t.Errorf("expected %d days, got %d", test.expectedDays, explanation.Days)
+			}
+			if explanation.TimeStartsAtApplied != test.expectedApplied {
+				t.Errorf("expected time starts at applied %t, got %t", test.expectedApplied, explanation.TimeStartsAtApplied)
+			}
+			if explanation.Action != test.expectedAction {
+				t.Errorf("expected action %s, got %s", test.expectedAction, explanation.Action)
+			}
+			if !explanation.PurgeDate.Equal(test.expectedDay.AddDate(0, 0, 30)) {
+				t.Errorf("unexpected purge date %s", explanation.PurgeDate)
+			}
+			if diff := cmp.Diff([]stageDate{{Stage: "notify", Date: test.expectedDay.AddDate(0, 0, 25)}}, explanation.NotifyDates); diff != "" {
+				t.Errorf("notify dates mismatch (-want +got):\n%s", diff)
+			}
+			if output := explanation.text(); !strings.Contains(output, test.expectedInOutput) {
+				t.Errorf("expected output to contain %q, got:\n%s", test.expectedInOutput, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"gopkg.in/yaml.v3"
+)
+
+const manifestHeader = "# Exported before this sandbox space was purged.\n" +
+	"# Environment variable values are not exported; set them before pushing.\n"
+
+// appManifest is a cf push manifest for the apps in a space
+type appManifest struct {
+	Applications []manifestApp `yaml:"applications"`
+}
+
+type manifestApp struct {
+	Name       string            `yaml:"name"`
+	Instances  int               `yaml:"instances,omitempty"`
+	Memory     string            `yaml:"memory,omitempty"`
+	DiskQuota  string            `yaml:"disk_quota,omitempty"`
+	Buildpacks []string          `yaml:"buildpacks,omitempty"`
+	Stack      string            `yaml:"stack,omitempty"`
+	Command    string            `yaml:"command,omitempty"`
+	Routes     []manifestRoute   `yaml:"routes,omitempty"`
+	Env        map[string]string `yaml:"env,omitempty"`
+}
+
+type manifestRoute struct {
+	Route string `yaml:"route"`
+}
+
+type exportedService struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Offering string `yaml:"offering,omitempty"`
+	Plan     string `yaml:"plan,omitempty"`
+}
+
+type exportedRoute struct {
+	URL  string   `yaml:"url"`
+	Apps []string `yaml:"apps,omitempty"`
+}
+
+// spaceExport describes what was deployed in a space before it was purged
+type spaceExport struct {
+	Manifest appManifest       `yaml:"manifest"`
+	Services []exportedService `yaml:"services"`
+	Routes   []exportedRoute   `yaml:"routes"`
+}
+
+// buildSpaceExport lists the apps, service instances and routes in a space
+func buildSpaceExport(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	space *resource.Space,
+) (*spaceExport, error) {
+	appListOptions := client.NewAppListOptions()
+	appListOptions.SpaceGUIDs.EqualTo(space.GUID)
+	apps, err := cfClient.Applications.ListAll(ctx, appListOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error listing apps: %w", err)
+	}
+
+	routeListOptions := client.NewRouteListOptions()
+	routeListOptions.SpaceGUIDs.EqualTo(space.GUID)
+	routes, err := cfClient.Routes.ListAll(ctx, routeListOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error listing routes: %w", err)
+	}
+
+	serviceListOptions := client.NewServiceInstanceListOptions()
+	serviceListOptions.SpaceGUIDs.EqualTo(space.GUID)
+	instances, err := cfClient.ServiceInstances.ListAll(ctx, serviceListOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error listing service instances: %w", err)
+	}
+
+	export := &spaceExport{
+		Manifest: appManifest{Applications: []manifestApp{}},
+		Services: []exportedService{},
+		Routes:   []exportedRoute{},
+	}
+
+	appNames := map[string]string{}
+	for _, app := range apps {
+		appNames[app.GUID] = app.Name
+	}
+
+	appRoutes := map[string][]manifestRoute{}
+	for _, route := range routes {
+		exported := exportedRoute{URL: route.URL}
+		for _, destination := range route.Destinations {
+			if destination.App.GUID == nil {
+				continue
+			}
+			appGUID := *destination.App.GUID
+			if name, ok := appNames[appGUID]; ok {
+				exported.Apps = append(exported.Apps, name)
+				appRoutes[appGUID] = append(appRoutes[appGUID], manifestRoute{Route: route.URL})
+			}
+		}
+		export.Routes = append(export.Routes, exported)
+	}
+
+	for _, app := range apps {
+		manifest, err := buildManifestApp(ctx, cfClient, app)
+		if err != nil {
+			return nil, fmt.Errorf("error exporting app %s: %w", app.Name, err)
+		}
+		manifest.Routes = appRoutes[app.GUID]
+		export.Manifest.Applications = append(export.Manifest.Applications, manifest)
+	}
+
+	export.Services, err = listExportedServices(ctx, cfClient, instances)
+	if err != nil {
+		return nil, fmt.Errorf("error listing service plans: %w", err)
+	}
+
+	return export, nil
+}
+
+// buildManifestApp exports an app's web process, lifecycle and env var names
+func buildManifestApp(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	app *resource.App,
+) (manifestApp, error) {
+	manifest := manifestApp{
+		Name:       app.Name,
+		Buildpacks: app.Lifecycle.BuildpackData.Buildpacks,
+		Stack:      app.Lifecycle.BuildpackData.Stack,
+	}
+
+	processes, err := cfClient.Processes.ListForAppAll(ctx, app.GUID, client.NewProcessOptions())
+	if err != nil {
+		return manifest, err
+	}
+	for _, process := range processes {
+		if process.Type != "web" {
+			continue
+		}
+		manifest.Instances = process.Instances
+		manifest.Memory = fmt.Sprintf("%dM", process.MemoryInMB)
+		manifest.DiskQuota = fmt.Sprintf("%dM", process.DiskInMB)
+		if process.Command != nil {
+			manifest.Command = *process.Command
+		}
+	}
+
+	envVars, err := cfClient.Applications.GetEnvironmentVariables(ctx, app.GUID)
+	if err != nil {
+		return manifest, err
+	}
+	if len(envVars) > 0 {
+		manifest.Env = map[string]string{}
+		for name := range envVars {
+			manifest.Env[name] = ""
+		}
+	}
+	return manifest, nil
+}
+
+// listExportedServices lists service instances with their offering and plan
+func listExportedServices(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	instances []*resource.ServiceInstance,
+) ([]exportedService, error) {
+	services := []exportedService{}
+	if len(instances) == 0 {
+		return services, nil
+	}
+
+	planListOptions := client.NewServicePlanListOptions()
+	for _, instance := range instances {
+		planListOptions.ServiceInstanceGUIDs.Values = append(planListOptions.ServiceInstanceGUIDs.Values, instance.GUID)
+	}
+	plans, offerings, err := cfClient.ServicePlans.ListIncludeServiceOfferingAll(ctx, planListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	planNames, planOfferings, offeringNames := map[string]string{}, map[string]string{}, map[string]string{}
+	for _, plan := range plans {
+		planNames[plan.GUID] = plan.Name
+		planOfferings[plan.GUID] = getRelationshipGUID(&plan.Relationships.ServiceOffering)
+	}
+	for _, offering := range offerings {
+		offeringNames[offering.GUID] = offering.Name
+	}
+
+	for _, instance := range instances {
+		planGUID := getRelationshipGUID(instance.Relationships.ServicePlan)
+		services = append(services, exportedService{
+			Name:     instance.Name,
+			Type:     instance.Type,
+			Offering: offeringNames[planOfferings[planGUID]],
+			Plan:     planNames[planGUID],
+		})
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, nil
+}
+
+// exportStore saves space exports to a directory, encrypted if a cipher is
+// configured
+type exportStore struct {
+	dir    string
+	cipher *artifactCipher
+}
+
+// newExportStore creates the export directory if needed
+func newExportStore(dir string, cipher *artifactCipher) (*exportStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating export directory %s: %w", dir, err)
+	}
+	return &exportStore{dir: dir, cipher: cipher}, nil
+}
+
+// write saves an export as a gzipped tar file and returns its file name,
+// which support staff can use to find it
+func (s *exportStore) write(space *resource.Space, now time.Time, export *spaceExport) (string, error) {
+	files := []struct {
+		name   string
+		header string
+		value  interface{}
+	}{
+		{name: "manifest.yml", header: manifestHeader, value: export.Manifest},
+		{name: "services.yml", value: map[string]interface{}{"services": export.Services}},
+		{name: "routes.yml", value: map[string]interface{}{"routes": export.Routes}},
+	}
+
+	name := fmt.Sprintf("%s-%s.tar.gz%s", space.GUID, now.Format("20060102"), s.cipher.extension())
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("error creating export %s: %w", name, err)
+	}
+	defer f.Close()
+
+	encrypted, err := s.cipher.wrap(f)
+	if err != nil {
+		return "", fmt.Errorf("error encrypting export %s: %w", name, err)
+	}
+	gz := gzip.NewWriter(encrypted)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		contents, err := yaml.Marshal(file.value)
+		if err != nil {
+			return "", fmt.Errorf("error encoding %s: %w", file.name, err)
+		}
+		contents = append([]byte(file.header), contents...)
+		header := &tar.Header{
+			Name:    file.name,
+			Mode:    0600,
+			Size:    int64(len(contents)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(contents); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if err := encrypted.Close(); err != nil {
+		return "", err
+	}
+	return name, f.Close()
+}
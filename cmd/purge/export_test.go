@@ -0,0 +1,181 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockServiceInstances struct {
+	instances []*resource.ServiceInstance
+}
+
+func (s *mockServiceInstances) ListAll(ctx context.Context, opts *client.ServiceInstanceListOptions) ([]*resource.ServiceInstance, error) {
+	return s.instances, nil
+}
+
+type mockProcesses struct {
+	processes map[string][]*resource.Process
+}
+
+func (p *mockProcesses) ListForAppAll(ctx context.Context, appGUID string, opts *client.ProcessListOptions) ([]*resource.Process, error) {
+	return p.processes[appGUID], nil
+}
+
+type mockServicePlans struct {
+	plans     []*resource.ServicePlan
+	offerings []*resource.ServiceOffering
+}
+
+func (p *mockServicePlans) ListIncludeServiceOfferingAll(ctx context.Context, opts *client.ServicePlanListOptions) ([]*resource.ServicePlan, []*resource.ServiceOffering, error) {
+	return p.plans, p.offerings, nil
+}
+
+func TestSpaceExport(t *testing.T) {
+	appGUID := "app-guid"
+	secret := "secret"
+	command := "./start.sh"
+	cfClient := &cfResourceClient{
+		Applications: &mockApplications{
+			apps: []*resource.App{
+				{
+					GUID: appGUID,
+					Name: "app",
+					Lifecycle: resource.Lifecycle{
+						BuildpackData: resource.BuildpackLifecycle{
+							Buildpacks: []string{"python_buildpack"},
+							Stack:      "cflinuxfs4",
+						},
+					},
+				},
+			},
+			envVars: map[string]*string{"API_KEY": &secret},
+		},
+		Processes: &mockProcesses{
+			processes: map[string][]*resource.Process{
+				appGUID: {
+					{Type: "web", Instances: 2, MemoryInMB: 256, DiskInMB: 1024, Command: &command},
+					{Type: "worker", Instances: 1, MemoryInMB: 128},
+				},
+			},
+		},
+		Routes: &mockRoutes{
+			routes: []*resource.Route{
+				{
+					URL:          "app.app.cloud.gov",
+					Destinations: []resource.RouteDestination{{App: resource.RouteDestinationApp{GUID: &appGUID}}},
+				},
+				{URL: "unmapped.app.cloud.gov"},
+			},
+		},
+		ServiceInstances: &mockServiceInstances{
+			instances: []*resource.ServiceInstance{
+				{
+					GUID: "instance-guid",
+					Name: "db",
+					Type: "managed",
+					Relationships: resource.ServiceInstanceRelationships{
+						ServicePlan: &resource.ToOneRelationship{
+							Data: &resource.Relationship{GUID: "plan-guid"},
+						},
+					},
+				},
+			},
+		},
+		ServicePlans: &mockServicePlans{
+			plans: []*resource.ServicePlan{
+				{
+					GUID: "plan-guid",
+					Name: "micro-psql",
+					Relationships: resource.ServicePlanRelationship{
+						ServiceOffering: resource.ToOneRelationship{
+							Data: &resource.Relationship{GUID: "offering-guid"},
+						},
+					},
+				},
+			},
+			offerings: []*resource.ServiceOffering{{GUID: "offering-guid", Name: "aws-rds"}},
+		},
+	}
+	space := &resource.Space{GUID: "space-guid", Name: "space"}
+
+	export, err := buildSpaceExport(context.Background(), cfClient, space)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := &spaceExport{
+		Manifest: appManifest{
+			Applications: []manifestApp{
+				{
+					Name:       "app",
+					Instances:  2,
+					Memory:     "256M",
+					DiskQuota:  "1024M",
+					Buildpacks: []string{"python_buildpack"},
+					Stack:      "cflinuxfs4",
+					Command:    "./start.sh",
+					Routes:     []manifestRoute{{Route: "app.app.cloud.gov"}},
+					Env:        map[string]string{"API_KEY": ""},
+				},
+			},
+		},
+		Services: []exportedService{
+			{Name: "db", Type: "managed", Offering: "aws-rds", Plan: "micro-psql"},
+		},
+		Routes: []exportedRoute{
+			{URL: "app.app.cloud.gov", Apps: []string{"app"}},
+			{URL: "unmapped.app.cloud.gov"},
+		},
+	}
+	if diff := cmp.Diff(expected, export); diff != "" {
+		t.Errorf("export mismatch (-want +got):\n%s", diff)
+	}
+
+	dir := t.TempDir()
+	exports, err := newExportStore(dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	name, err := exports.write(space, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), export)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if name != "space-guid-20240501.tar.gz" {
+		t.Errorf("unexpected export name %s", name)
+	}
+
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tr := tar.NewReader(gz)
+	var files []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		files = append(files, header.Name)
+	}
+	if diff := cmp.Diff([]string{"manifest.yml", "services.yml", "routes.yml"}, files); diff != "" {
+		t.Errorf("files mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var foundationNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Foundation describes one CF foundation to clean up; empty fields fall back
+// to the matching env vars
+type Foundation struct {
+	Name             string   `yaml:"name"`
+	APIAddress       string   `yaml:"api_address"`
+	ClientID         string   `yaml:"client_id"`
+	ClientSecret     string   `yaml:"client_secret"`
+	ClientSecretFile string   `yaml:"client_secret_file"`
+	OrgPrefix        string   `yaml:"org_prefix"`
+	OrgLabelSelector string   `yaml:"org_label_selector"`
+	OrgQuotaName     string   `yaml:"org_quota_name"`
+	OrgInclude       []string `yaml:"org_include"`
+	OrgExclude       []string `yaml:"org_exclude"`
+	SandboxQuotaName string   `yaml:"sandbox_quota_name"`
+}
+
+type foundationsFile struct {
+	Foundations []Foundation `yaml:"foundations"`
+}
+
+// loadFoundations reads the list of foundations from FOUNDATIONS_FILE
+func loadFoundations(filename string) ([]Foundation, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var file foundationsFile
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("error parsing foundations file %s: %w", filename, err)
+	}
+	if err := validateFoundations(file.Foundations); err != nil {
+		return nil, fmt.Errorf("error validating foundations file %s: %w", filename, err)
+	}
+	return file.Foundations, nil
+}
+
+func validateFoundations(foundations []Foundation) error {
+	if len(foundations) == 0 {
+		return errors.New("no foundations listed")
+	}
+	var problems []error
+	seen := map[string]bool{}
+	for i, foundation := range foundations {
+		if !foundationNamePattern.MatchString(foundation.Name) {
+			problems = append(problems, fmt.Errorf("foundation %d needs a name of letters, digits, dashes and underscores, got %q", i, foundation.Name))
+			continue
+		}
+		if seen[foundation.Name] {
+			problems = append(problems, fmt.Errorf("foundation %s is listed more than once", foundation.Name))
+		}
+		seen[foundation.Name] = true
+		if foundation.ClientSecret != "" && foundation.ClientSecretFile != "" {
+			problems = append(problems, fmt.Errorf("foundation %s: set only one of client_secret and client_secret_file", foundation.Name))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// listFoundations returns the foundations to run against; without
+// FOUNDATIONS_FILE, that's a single unnamed foundation set by the env vars
+func listFoundations(opts Options) []Foundation {
+	if len(opts.Foundations) == 0 {
+		return []Foundation{{}}
+	}
+	return opts.Foundations
+}
+
+// foundationOptions returns the options for one foundation: its settings
+// replace the env vars, and the ledger, snapshots, exports and plan files
+// get its name so foundations never share state
+func foundationOptions(opts Options, foundation Foundation) Options {
+	if foundation.APIAddress != "" {
+		opts.APIAddress = foundation.APIAddress
+	}
+	if foundation.ClientID != "" {
+		opts.ClientID = foundation.ClientID
+	}
+	if foundation.ClientSecret != "" || foundation.ClientSecretFile != "" {
+		opts.ClientSecret = foundation.ClientSecret
+		opts.ClientSecretFile = foundation.ClientSecretFile
+	}
+	if foundation.OrgPrefix != "" {
+		opts.OrgPrefix = foundation.OrgPrefix
+	}
+	if foundation.OrgLabelSelector != "" {
+		opts.OrgLabelSelector = foundation.OrgLabelSelector
+	}
+	if foundation.OrgQuotaName != "" {
+		opts.OrgQuotaName = foundation.OrgQuotaName
+	}
+	if len(foundation.OrgInclude) > 0 {
+		opts.OrgInclude = foundation.OrgInclude
+	}
+	if len(foundation.OrgExclude) > 0 {
+		opts.OrgExclude = foundation.OrgExclude
+	}
+	if foundation.SandboxQuotaName != "" {
+		opts.SandboxQuotaName = foundation.SandboxQuotaName
+	}
+
+	if foundation.Name != "" {
+		opts.LedgerFile = foundationFile(opts.LedgerFile, foundation.Name)
+		if opts.SnapshotDir != "" {
+			opts.SnapshotDir = filepath.Join(opts.SnapshotDir, foundation.Name)
+		}
+		if opts.ExportDir != "" {
+			opts.ExportDir = filepath.Join(opts.ExportDir, foundation.Name)
+		}
+	}
+	return opts
+}
+
+// foundationFile adds a foundation's name to a file name, e.g. ledger.json to
+// ledger-east.json
+func foundationFile(filename string, foundation string) string {
+	if filename == "" || foundation == "" {
+		return filename
+	}
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "-" + foundation + ext
+}
+
+// validateFoundationOptions checks the settings each foundation needs, from
+// its own entry or the env vars
+func validateFoundationOptions(opts Options) error {
+	var problems []error
+	for _, foundation := range listFoundations(opts) {
+		fopts := foundationOptions(opts, foundation)
+		var missing []string
+		for _, required := range []struct {
+			env   string
+			value string
+		}{
+			{env: "API_ADDRESS", value: fopts.APIAddress},
+			{env: "CLIENT_ID", value: fopts.ClientID},
+			{env: "SANDBOX_QUOTA_NAME", value: fopts.SandboxQuotaName},
+		} {
+			if required.value == "" {
+				missing = append(missing, required.env)
+			}
+		}
+
+		prefix := ""
+		if foundation.Name != "" {
+			prefix = fmt.Sprintf("foundation %s: ", foundation.Name)
+		}
+		for _, env := range missing {
+			problems = append(problems, fmt.Errorf("%smissing required option %s", prefix, env))
+		}
+		if fopts.ClientSecret == "" && fopts.ClientSecretFile == "" {
+			problems = append(problems, fmt.Errorf("%sCLIENT_SECRET or CLIENT_SECRET_FILE is required", prefix))
+		}
+		for _, err := range validateOrgSelection(fopts) {
+			problems = append(problems, fmt.Errorf("%s%w", prefix, err))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// foundationRun is the outcome of a run on one foundation
+type foundationRun struct {
+	Foundation string      `json:"foundation,omitempty"`
+	Summary    *runSummary `json:"summary,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// runFoundations runs a command on every foundation at once, so an error or
+// a slow API on one foundation doesn't hold up the others; secrets are read
+// again first so rotated secrets are picked up
+func runFoundations(ctx context.Context, runners []*runner, cmd cliCommand) []foundationRun {
+	runs := make([]foundationRun, len(runners))
+	forEachParallel(len(runners), len(runners), func(i int) {
+		r := runners[i]
+		runs[i].Foundation = r.foundation
+		err := r.reloadSecrets()
+		if err == nil {
+			runs[i].Summary, err = r.run(ctx, cmd)
+		}
+		if err != nil {
+			runs[i].Error = err.Error()
+		}
+	})
+	return runs
+}
+
+// logFoundationRuns logs the summary or error of each foundation's run
+func logFoundationRuns(ctx context.Context, runs []foundationRun) {
+	for _, run := range runs {
+		ctx := ctx
+		if run.Foundation != "" {
+			ctx = withLogAttrs(ctx, "foundation", run.Foundation)
+		}
+		if run.Error != "" {
+			slog.ErrorContext(ctx, "run failed", "error", run.Error)
+		} else if run.Summary != nil {
+			logRunSummary(ctx, run.Summary)
+		}
+	}
+}
+
+// foundationsExitCode combines the outcomes of several foundations like
+// runSummary.exitCode, counting a foundation whose run failed outright as a
+// failed action
+func foundationsExitCode(runs []foundationRun) int {
+	combined := runSummary{}
+	for _, run := range runs {
+		if run.Error != "" {
+			combined.Failures = append(combined.Failures, runFailure{Error: run.Error})
+			continue
+		}
+		if run.Summary != nil {
+			combined.Succeeded += run.Summary.Succeeded
+			combined.Failures = append(combined.Failures, run.Summary.Failures...)
+		}
+	}
+	return combined.exitCode()
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockOrganizations struct {
+	orgs []*resource.Organization
+	// labelled lists the GUIDs of orgs matching any label selector
+	labelled []string
+	err      error
+}
+
+func (o *mockOrganizations) ListAll(ctx context.Context, opts *client.OrganizationListOptions) ([]*resource.Organization, error) {
+	if o.err != nil || opts == nil {
+		return o.orgs, o.err
+	}
+	orgs := []*resource.Organization{}
+	for _, org := range o.orgs {
+		if len(opts.LabelSel) > 0 && !slices.Contains(o.labelled, org.GUID) {
+			continue
+		}
+		if len(opts.Names.Values) > 0 && !slices.Contains(opts.Names.Values, org.Name) {
+			continue
+		}
+		if len(opts.GUIDs.Values) > 0 && !slices.Contains(opts.GUIDs.Values, org.GUID) {
+			continue
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
+
+func (o *mockOrganizations) Single(ctx context.Context, opts *client.OrganizationListOptions) (*resource.Organization, error) {
+	return nil, client.ErrNoResultsReturned
+}
+
+type mockUsers struct {
+	users []*resource.User
+}
+
+func (u *mockUsers) ListAll(ctx context.Context, opts *client.UserListOptions) ([]*resource.User, error) {
+	return u.users, nil
+}
+
+func TestLoadFoundations(t *testing.T) {
+	testCases := map[string]struct {
+		contents       string
+		expected       []Foundation
+		expectedErrors []string
+	}{
+		"valid": {
+			contents: `
+foundations:
+- name: east
+  api_address: https://api.east.example.gov
+  client_secret_file: /secrets/east
+- name: west
+  api_address: https://api.west.example.gov
+  org_prefix: sbx-
+`,
+			expected: []Foundation{
+				{Name: "east", APIAddress: "https://api.east.example.gov", ClientSecretFile: "/secrets/east"},
+				{Name: "west", APIAddress: "https://api.west.example.gov", OrgPrefix: "sbx-"},
+			},
+		},
+		"invalid": {
+			contents: `
+foundations:
+- name: east
+  client_secret: secret
+  client_secret_file: /secrets/east
+- name: east
+- name: ../west
+`,
+			expectedErrors: []string{
+				"foundation east: set only one of client_secret and client_secret_file",
+				"foundation east is listed more than once",
+				`foundation 2 needs a name of letters, digits, dashes and underscores, got "../west"`,
+			},
+		},
+		"empty": {
+			contents:       `foundations: []`,
+			expectedErrors: []string{"no foundations listed"},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "foundations.yml")
+			if err := os.WriteFile(filename, []byte(test.contents), 0o600); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			got, err := loadFoundations(filename)
+			checkProblems(t, err, test.expectedErrors)
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("unexpected foundations (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFoundationOptions(t *testing.T) {
+	opts := Options{
+		APIAddress:       "https://api.example.gov",
+		ClientID:         "purge",
+		ClientSecret:     "secret",
+		OrgPrefix:        "sandbox-",
+		SandboxQuotaName: "sandbox",
+		LedgerFile:       "/state/ledger.json",
+		SnapshotDir:      "/state/snapshots",
+	}
+
+	testCases := map[string]struct {
+		foundation Foundation
+		expected   Options
+	}{
+		"unnamed": {
+			foundation: Foundation{},
+			expected:   opts,
+		},
+		"overrides": {
+			foundation: Foundation{
+				Name:             "east",
+				APIAddress:       "https://api.east.example.gov",
+				ClientSecretFile: "/secrets/east",
+				SandboxQuotaName: "east-sandbox",
+			},
+			expected: Options{
+				APIAddress:       "https://api.east.example.gov",
+				ClientID:         "purge",
+				ClientSecretFile: "/secrets/east",
+				OrgPrefix:        "sandbox-",
+				SandboxQuotaName: "east-sandbox",
+				LedgerFile:       "/state/ledger-east.json",
+				SnapshotDir:      "/state/snapshots/east",
+			},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := foundationOptions(opts, test.foundation)
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("unexpected options (-expected +got):\n%s", diff)
+			}
+		})
+	}
+
+	err := validateFoundationOptions(Options{
+		APIAddress:       "https://api.example.gov",
+		ClientID:         "purge",
+		SandboxQuotaName: "sandbox",
+		Foundations: []Foundation{
+			{Name: "east", OrgPrefix: "sandbox-", ClientSecret: "secret"},
+			{Name: "west"},
+		},
+	})
+	checkProblems(t, err, []string{
+		"foundation west: one of ORG_PREFIX, ORG_LABEL_SELECTOR, ORG_QUOTA_NAME or ORG_INCLUDE is required",
+		"foundation west: CLIENT_SECRET or CLIENT_SECRET_FILE is required",
+	})
+}
+
+func TestRunFoundations(t *testing.T) {
+	newTestRunner := func(foundation string, orgsErr error) *runner {
+		return &runner{
+			foundation: foundation,
+			cfClient: &cfResourceClient{
+				Organizations: &mockOrganizations{err: orgsErr},
+				Users:         &mockUsers{},
+			},
+			opts:       Options{DryRun: true, Concurrency: 1, OrgPrefix: "sandbox-"},
+			metrics:    newRunMetrics(),
+			mailSender: &mockMailSender{},
+		}
+	}
+	// The client for north can't be built, as if its API were down
+	north := newTestRunner("north", nil)
+	north.cfClient = nil
+	north.newClient = func(opts Options) (*cfResourceClient, error) {
+		return nil, errors.New("connection refused")
+	}
+	runners := []*runner{
+		newTestRunner("east", errors.New("connection refused")),
+		newTestRunner("west", nil),
+		north,
+	}
+
+	runs := runFoundations(context.Background(), runners, cliCommand{Name: commandRun})
+	if len(runs) != 3 {
+		t.Fatalf("expected a run per foundation, got %d", len(runs))
+	}
+	if runs[2].Foundation != "north" || runs[2].Error != "error creating client: connection refused" {
+		t.Errorf("expected north to fail, got %+v", runs[2])
+	}
+	if runs[0].Foundation != "east" || runs[0].Error != "error getting orgs: connection refused" {
+		t.Errorf("expected east to fail, got %+v", runs[0])
+	}
+	if runs[1].Foundation != "west" || runs[1].Error != "" || runs[1].Summary == nil {
+		t.Errorf("expected west to succeed despite east, got %+v", runs[1])
+	}
+
+	testCases := map[string]struct {
+		runs     []foundationRun
+		expected int
+	}{
+		"all succeeded": {
+			runs:     []foundationRun{{Summary: &runSummary{Succeeded: 2}}, {Summary: &runSummary{Succeeded: 1}}},
+			expected: 0,
+		},
+		"one foundation failed": {
+			runs:     []foundationRun{{Error: "boom"}, {Summary: &runSummary{Succeeded: 1}}},
+			expected: exitPartialFailure,
+		},
+		"every foundation failed": {
+			runs:     []foundationRun{{Error: "boom"}, {Summary: &runSummary{Failures: []runFailure{{Error: "boom"}}}}},
+			expected: exitTotalFailure,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := foundationsExitCode(test.runs); got != test.expected {
+				t.Errorf("expected exit code %d, got %d", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// notifyLedger records the reminder stages sent for each space, so that a
+// space is notified once per stage per first-resource timestamp
+type notifyLedger struct {
+	filename string
+	mu       sync.Mutex
+	Spaces   map[string]*ledgerEntry `json:"spaces"`
+}
+
+type ledgerEntry struct {
+	FirstResource time.Time `json:"first_resource"`
+	Stages        []string  `json:"stages"`
+}
+
+// loadNotifyLedger reads a ledger file; a missing file is an empty ledger
+func loadNotifyLedger(filename string) (*notifyLedger, error) {
+	ledger := &notifyLedger{
+		filename: filename,
+		Spaces:   map[string]*ledgerEntry{},
+	}
+
+	contents, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, ledger); err != nil {
+		return nil, fmt.Errorf("error parsing ledger file %s: %w", filename, err)
+	}
+	if ledger.Spaces == nil {
+		ledger.Spaces = map[string]*ledgerEntry{}
+	}
+	return ledger, nil
+}
+
+// hasNotified reports whether the stage was already sent for the space's
+// current first-resource timestamp
+func (l *notifyLedger) hasNotified(details SpaceDetails) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.Spaces[details.Space.GUID]
+	if !ok || !entry.FirstResource.Equal(details.Timestamp) {
+		return false
+	}
+	for _, stage := range entry.Stages {
+		if stage == details.Stage.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// recordNotified records a sent stage and saves the ledger; a new
+// first-resource timestamp starts a fresh cycle for the space
+func (l *notifyLedger) recordNotified(details SpaceDetails) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.Spaces[details.Space.GUID]
+	if !ok || !entry.FirstResource.Equal(details.Timestamp) {
+		entry = &ledgerEntry{FirstResource: details.Timestamp}
+		l.Spaces[details.Space.GUID] = entry
+	}
+	entry.Stages = append(entry.Stages, details.Stage.Name)
+	return l.save()
+}
+
+// forget removes a purged space from the ledger and saves it
+func (l *notifyLedger) forget(spaceGUID string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.Spaces[spaceGUID]; !ok {
+		return nil
+	}
+	delete(l.Spaces, spaceGUID)
+	return l.save()
+}
+
+// save writes the ledger to a temporary file and renames it into place, so
+// an interrupted run never leaves a partial ledger
+func (l *notifyLedger) save() error {
+	contents, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.filename), filepath.Base(l.filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.filename)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+func TestNotifyLedger(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ledger.json")
+	firstResource := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	reminder := SpaceDetails{
+		Timestamp: firstResource,
+		Space:     &resource.Space{GUID: "space-guid"},
+		Stage:     &NotifyStage{Name: "7-days"},
+	}
+	final := SpaceDetails{
+		Timestamp: firstResource,
+		Space:     &resource.Space{GUID: "space-guid"},
+		Stage:     &NotifyStage{Name: "final"},
+	}
+
+	ledger, err := loadNotifyLedger(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ledger.hasNotified(reminder) {
+		t.Fatal("expected empty ledger to have no notifications")
+	}
+	if err := ledger.recordNotified(reminder); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ledger, err = loadNotifyLedger(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ledger.hasNotified(reminder) {
+		t.Fatal("expected saved ledger to have reminder notification")
+	}
+	if ledger.hasNotified(final) {
+		t.Fatal("expected saved ledger not to have final notification")
+	}
+
+	restarted := reminder
+	restarted.Timestamp = firstResource.Add(40 * 24 * time.Hour)
+	if ledger.hasNotified(restarted) {
+		t.Fatal("expected new first resource timestamp to start a fresh cycle")
+	}
+	if err := ledger.recordNotified(restarted); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ledger.hasNotified(reminder) {
+		t.Fatal("expected fresh cycle to replace previous notifications")
+	}
+
+	if err := ledger.forget("space-guid"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ledger, err = loadNotifyLedger(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ledger.hasNotified(restarted) {
+		t.Fatal("expected forgotten space to have no notifications")
+	}
+}
+
+func TestNilNotifyLedger(t *testing.T) {
+	var ledger *notifyLedger
+	details := SpaceDetails{
+		Space: &resource.Space{GUID: "space-guid"},
+		Stage: &NotifyStage{Name: "final"},
+	}
+	if ledger.hasNotified(details) {
+		t.Fatal("expected nil ledger to have no notifications")
+	}
+	if err := ledger.recordNotified(details); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// checkPurgeLimits compares the purges in a plan with MAX_PURGES_PER_RUN,
+// MAX_PURGES_PER_ORG and MAX_PURGE_PERCENT, describing each limit exceeded;
+// a limit of 0 is not enforced
+func checkPurgeLimits(plan *Plan, opts Options) []string {
+	var violations []string
+	totalPurges, totalSpaces := 0, 0
+
+	for _, org := range plan.Orgs {
+		purges := 0
+		for _, action := range org.Actions {
+			if action.Action == actionPurge {
+				purges++
+			}
+		}
+		totalPurges += purges
+		totalSpaces += org.SpaceCount
+
+		if opts.MaxPurgesPerOrg > 0 && purges > opts.MaxPurgesPerOrg {
+			violations = append(violations, fmt.Sprintf(
+				"org %s has %d spaces to purge, more than MAX_PURGES_PER_ORG (%d)",
+				org.Org.Name, purges, opts.MaxPurgesPerOrg,
+			))
+		}
+	}
+
+	if opts.MaxPurgesPerRun > 0 && totalPurges > opts.MaxPurgesPerRun {
+		violations = append(violations, fmt.Sprintf(
+			"%d spaces to purge, more than MAX_PURGES_PER_RUN (%d)",
+			totalPurges, opts.MaxPurgesPerRun,
+		))
+	}
+
+	if opts.MaxPurgePercent > 0 && totalSpaces > 0 {
+		percent := 100 * float64(totalPurges) / float64(totalSpaces)
+		if percent > opts.MaxPurgePercent {
+			violations = append(violations, fmt.Sprintf(
+				"%d of %d sandbox spaces (%.1f%%) to purge, more than MAX_PURGE_PERCENT (%g%%)",
+				totalPurges, totalSpaces, percent, opts.MaxPurgePercent,
+			))
+		}
+	}
+
+	return violations
+}
+
+// enforcePurgeLimits drops the purges and route deletions from a plan that
+// exceeds a safety limit, unless mass purges are allowed, so reminders are
+// still sent; the error describes the limits exceeded
+func enforcePurgeLimits(ctx context.Context, plan *Plan, opts Options) (*Plan, error) {
+	violations := checkPurgeLimits(plan, opts)
+	if len(violations) == 0 {
+		return plan, nil
+	}
+	if opts.AllowMassPurge {
+		slog.WarnContext(ctx, "safety limits exceeded, continuing because mass purges are allowed", "violations", violations)
+		return plan, nil
+	}
+	slog.ErrorContext(ctx, "safety limits exceeded, sending reminders but not purging", "violations", violations)
+	return filterPlan(plan, actionNotify), fmt.Errorf("refusing to purge; safety limits exceeded:\n%s\nset ALLOW_MASS_PURGE or --allow-mass-purge to purge anyway", strings.Join(violations, "\n"))
+}
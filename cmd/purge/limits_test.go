@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckPurgeLimits(t *testing.T) {
+	newOrg := func(name string, spaces int, purges int) PlanOrg {
+		org := PlanOrg{Org: &resource.Organization{Name: name}, SpaceCount: spaces}
+		for range purges {
+			org.Actions = append(org.Actions, PlanAction{Action: actionPurge})
+		}
+		org.Actions = append(org.Actions, PlanAction{Action: actionNotify})
+		return org
+	}
+	plan := &Plan{
+		Orgs: []PlanOrg{
+			newOrg("sandbox-a", 10, 1),
+			newOrg("sandbox-b", 10, 5),
+		},
+	}
+
+	testCases := map[string]struct {
+		opts               Options
+		expectedViolations []string
+	}{
+		"no limits": {},
+		"within limits": {
+			opts: Options{
+				MaxPurgesPerRun: 6,
+				MaxPurgesPerOrg: 5,
+				MaxPurgePercent: 30,
+			},
+		},
+		"per org limit": {
+			opts: Options{MaxPurgesPerOrg: 2},
+			expectedViolations: []string{
+				"org sandbox-b has 5 spaces to purge, more than MAX_PURGES_PER_ORG (2)",
+			},
+		},
+		"per run limit": {
+			opts: Options{MaxPurgesPerRun: 5},
+			expectedViolations: []string{
+				"6 spaces to purge, more than MAX_PURGES_PER_RUN (5)",
+			},
+		},
+		"percent limit": {
+			opts: Options{MaxPurgePercent: 25},
+			expectedViolations: []string{
+				"6 of 20 sandbox spaces (30.0%) to purge, more than MAX_PURGE_PERCENT (25%)",
+			},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			violations := checkPurgeLimits(plan, test.opts)
+			if diff := cmp.Diff(test.expectedViolations, violations); diff != "" {
+				t.Errorf("violations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEnforcePurgeLimits(t *testing.T) {
+	plan := &Plan{
+		Orgs: []PlanOrg{
+			{
+				Org:        &resource.Organization{Name: "sandbox-a"},
+				SpaceCount: 2,
+				Actions: []PlanAction{
+					{Action: actionPurge},
+					{Action: actionNotify},
+					{Action: actionDeleteRoutes},
+				},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		opts            Options
+		expectedActions []string
+		expectedErr     bool
+	}{
+		"within limits": {
+			expectedActions: []string{actionPurge, actionNotify, actionDeleteRoutes},
+		},
+		"limit exceeded still notifies": {
+			opts:            Options{MaxPurgePercent: 25},
+			expectedActions: []string{actionNotify},
+			expectedErr:     true,
+		},
+		"mass purge allowed": {
+			opts:            Options{MaxPurgePercent: 25, AllowMassPurge: true},
+			expectedActions: []string{actionPurge, actionNotify, actionDeleteRoutes},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := enforcePurgeLimits(context.Background(), plan, test.opts)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var actions []string
+			for _, action := range got.Orgs[0].Actions {
+				actions = append(actions, action.Action)
+			}
+			if diff := cmp.Diff(test.expectedActions, actions); diff != "" {
+				t.Errorf("actions mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+const (
+	redactNone = "none"
+	redactMask = "mask"
+	redactHash = "hash"
+)
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// newLogger builds the job's logger: JSON or text lines at a minimum level,
+// with email addresses redacted and attributes added from the context
+func newLogger(opts Options, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.LogLevel)); err != nil {
+		return nil, fmt.Errorf("error parsing log level %q: %w", opts.LogLevel, err)
+	}
+
+	redact, err := newEmailRedactor(opts.LogRedact)
+	if err != nil {
+		return nil, err
+	}
+	handlerOpts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			return redactAttr(a, redact)
+		},
+	}
+
+	var handler slog.Handler
+	switch opts.LogFormat {
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	case logFormatText:
+		handler = slog.NewTextHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q; expected %s or %s", opts.LogFormat, logFormatJSON, logFormatText)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// newEmailRedactor returns a function that masks (f***@bar.gov) or hashes
+// (3f1a9c0e7b2d@bar.gov) email addresses; hashes let operators match lines
+// for the same user without seeing the address
+func newEmailRedactor(mode string) (func(string) string, error) {
+	switch mode {
+	case redactNone:
+		return func(s string) string { return s }, nil
+	case redactMask:
+		return func(s string) string {
+			return emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+				local, domain, _ := strings.Cut(email, "@")
+				return local[:1] + "***@" + domain
+			})
+		}, nil
+	case redactHash:
+		return func(s string) string {
+			return emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+				_, domain, _ := strings.Cut(email, "@")
+				sum := sha256.Sum256([]byte(strings.ToLower(email)))
+				return hex.EncodeToString(sum[:6]) + "@" + domain
+			})
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown log redaction %q; expected %s, %s or %s", mode, redactNone, redactMask, redactHash)
+}
+
+// redactAttr redacts email addresses in string, string slice and error values,
+// including the log message
+func redactAttr(a slog.Attr, redact func(string) string) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case []string:
+			redacted := make([]string, len(v))
+			for i, s := range v {
+				redacted[i] = redact(s)
+			}
+			a.Value = slog.AnyValue(redacted)
+		case error:
+			a.Value = slog.StringValue(redact(v.Error()))
+		}
+	}
+	return a
+}
+
+type logAttrsKey struct{}
+
+// withLogAttrs returns a context whose log lines carry the given key-value
+// pairs, replacing any earlier values for the same keys
+func withLogAttrs(ctx context.Context, args ...any) context.Context {
+	added := slog.Group("", args...).Value.Group()
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+
+	attrs := make([]slog.Attr, 0, len(existing)+len(added))
+	for _, attr := range existing {
+		replaced := false
+		for _, a := range added {
+			if a.Key == attr.Key {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			attrs = append(attrs, attr)
+		}
+	}
+	attrs = append(attrs, added...)
+	return context.WithValue(ctx, logAttrsKey{}, attrs)
+}
+
+// contextHandler adds the attributes from withLogAttrs to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// newRunID returns a short random ID to tell runs apart in the logs
+func newRunID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
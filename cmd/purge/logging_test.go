@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEmailRedactor(t *testing.T) {
+	testCases := map[string]struct {
+		mode        string
+		expected    string
+		expectedErr bool
+	}{
+		"none": {
+			mode:     redactNone,
+			expected: "sending to foo@bar.gov and baz@qux.gov",
+		},
+		"mask": {
+			mode:     redactMask,
+			expected: "sending to f***@bar.gov and b***@qux.gov",
+		},
+		"hash": {
+			mode:     redactHash,
+			expected: "sending to dadbf4b1b6c3@bar.gov and 6147d79161bd@qux.gov",
+		},
+		"unknown": {
+			mode:        "shred",
+			expectedErr: true,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			redact, err := newEmailRedactor(test.mode)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for mode %s", test.mode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := redact("sending to foo@bar.gov and baz@qux.gov")
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	testCases := map[string]struct {
+		level    string
+		expected []map[string]any
+	}{
+		"info": {
+			level: "info",
+			expected: []map[string]any{
+				{
+					"level":      "INFO",
+					"msg":        "sending email",
+					"run_id":     "abc123",
+					"phase":      "purge",
+					"org":        "sandbox-gsa",
+					"space_guid": "space-guid",
+					"recipients": []any{"f***@bar.gov"},
+				},
+				{
+					"level":      "ERROR",
+					"msg":        "error sending mail",
+					"run_id":     "abc123",
+					"phase":      "purge",
+					"org":        "sandbox-gsa",
+					"space_guid": "space-guid",
+					"error":      "rejected f***@bar.gov",
+				},
+			},
+		},
+		"debug logs email bodies": {
+			level: "debug",
+			expected: []map[string]any{
+				{
+					"level":      "INFO",
+					"msg":        "sending email",
+					"run_id":     "abc123",
+					"phase":      "purge",
+					"org":        "sandbox-gsa",
+					"space_guid": "space-guid",
+					"recipients": []any{"f***@bar.gov"},
+				},
+				{
+					"level":      "DEBUG",
+					"msg":        "email body",
+					"run_id":     "abc123",
+					"phase":      "purge",
+					"org":        "sandbox-gsa",
+					"space_guid": "space-guid",
+					"body":       "hello f***@bar.gov",
+				},
+				{
+					"level":      "ERROR",
+					"msg":        "error sending mail",
+					"run_id":     "abc123",
+					"phase":      "purge",
+					"org":        "sandbox-gsa",
+					"space_guid": "space-guid",
+					"error":      "rejected f***@bar.gov",
+				},
+			},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := newLogger(Options{LogFormat: logFormatJSON, LogLevel: test.level, LogRedact: redactMask}, &buf)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			ctx := withLogAttrs(context.Background(), "run_id", "abc123", "phase", "plan")
+			ctx = withLogAttrs(ctx, "org", "sandbox-gsa", "space_guid", "space-guid", "phase", "purge")
+			logger.InfoContext(ctx, "sending email", "recipients", []string{"foo@bar.gov"})
+			logger.DebugContext(ctx, "email body", "body", "hello foo@bar.gov")
+			logger.ErrorContext(ctx, "error sending mail", "error", errors.New("rejected foo@bar.gov"))
+
+			got := []map[string]any{}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var record map[string]any
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				delete(record, slog.TimeKey)
+				got = append(got, record)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("unexpected records (-expected +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, opts := range []Options{
+		{LogFormat: "xml", LogLevel: "info", LogRedact: redactMask},
+		{LogFormat: logFormatJSON, LogLevel: "loud", LogRedact: redactMask},
+		{LogFormat: logFormatJSON, LogLevel: "info", LogRedact: "shred"},
+	} {
+		if _, err := newLogger(opts, &bytes.Buffer{}); err == nil {
+			t.Errorf("expected error for options %+v", opts)
+		}
+	}
+}
@@ -14,8 +14,13 @@ type SMTPOptions struct {
 	SMTPHost string `env:"SMTP_HOST, required"`
 	SMTPPort int    `env:"SMTP_PORT, default=587"`
 	SMTPUser string `env:"SMTP_USER, required"`
-	SMTPPass string `env:"SMTP_PASS, required"`
+	SMTPPass string `env:"SMTP_PASS"`
 	SMTPCert string `env:"SMTP_CERT"`
+
+	// SMTPPassFile and SMTPCertFile name files to read SMTPPass and SMTPCert
+	// from instead
+	SMTPPassFile string `env:"SMTP_PASS_FILE"`
+	SMTPCertFile string `env:"SMTP_CERT_FILE"`
 }
 
 type mailer interface {
@@ -53,16 +58,7 @@ func (m *smtpMailer) sendMail(
 		return nil
 	}
 
-	d := gomail.NewDialer(opts.SMTPHost, opts.SMTPPort, opts.SMTPUser, opts.SMTPPass)
-	if opts.SMTPCert != "" {
-		pool := x509.NewCertPool()
-		pool.AppendCertsFromPEM([]byte(opts.SMTPCert))
-		d.TLSConfig = &tls.Config{
-			ServerName: opts.SMTPHost,
-			RootCAs:    pool,
-		}
-	}
-	s, err := d.Dial()
+	s, err := newSMTPDialer(opts).Dial()
 	if err != nil {
 		return err
 	}
@@ -76,3 +72,26 @@ func (m *smtpMailer) sendMail(
 	msg.SetBody("text/html", body)
 	return gomail.Send(s, msg)
 }
+
+// checkConnection connects and authenticates to the SMTP server without
+// sending mail
+func (m *smtpMailer) checkConnection(opts SMTPOptions) error {
+	s, err := newSMTPDialer(opts).Dial()
+	if err != nil {
+		return err
+	}
+	return s.Close()
+}
+
+func newSMTPDialer(opts SMTPOptions) *gomail.Dialer {
+	d := gomail.NewDialer(opts.SMTPHost, opts.SMTPPort, opts.SMTPUser, opts.SMTPPass)
+	if opts.SMTPCert != "" {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(opts.SMTPCert))
+		d.TLSConfig = &tls.Config{
+			ServerName: opts.SMTPHost,
+			RootCAs:    pool,
+		}
+	}
+	return d
+}
@@ -16,6 +16,16 @@ func TestRenderTemplate(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
+	finalNotifyTemplate, err := template.ParseFiles("../../templates/base.html", "../../templates/notify-final.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	routesTemplate, err := template.ParseFiles("../../templates/base.html", "../../templates/routes.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
 	purgeTemplate, err := template.ParseFiles("../../templates/base.html", "../../templates/purge.tmpl")
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
@@ -41,6 +51,21 @@ func TestRenderTemplate(t *testing.T) {
 			},
 			expectedTestFile: "../../testdata/notify.html",
 		},
+		"constructs the appropriate final notify template": {
+			tpl: finalNotifyTemplate,
+			data: map[string]interface{}{
+				"org": &resource.Organization{
+					Name: "test-org",
+				},
+				"space": &resource.Space{
+					Name: "test-space",
+				},
+				"date":  time.Date(2009, 11, 17, 20, 34, 58, 651387237, time.UTC),
+				"days":  90,
+				"stage": "final",
+			},
+			expectedTestFile: "../../testdata/notify-final.html",
+		},
 		"constructs the appropriate purge template": {
 			tpl: purgeTemplate,
 			data: map[string]interface{}{
@@ -55,6 +80,37 @@ func TestRenderTemplate(t *testing.T) {
 			},
 			expectedTestFile: "../../testdata/purge.html",
 		},
+		"constructs the appropriate purge template with an export": {
+			tpl: purgeTemplate,
+			data: map[string]interface{}{
+				"org": &resource.Organization{
+					Name: "test-org",
+				},
+				"space": &resource.Space{
+					Name: "test-space",
+				},
+				"days":   90,
+				"export": "space-guid-20091117.tar.gz",
+			},
+			expectedTestFile: "../../testdata/purge-export.html",
+		},
+		"constructs the appropriate routes template": {
+			tpl: routesTemplate,
+			data: map[string]interface{}{
+				"org": &resource.Organization{
+					Name: "test-org",
+				},
+				"space": &resource.Space{
+					Name: "test-space",
+				},
+				"routes": []*resource.Route{
+					{URL: "one.app.cloud.gov"},
+					{URL: "two.app.cloud.gov/path"},
+				},
+				"days": 14,
+			},
+			expectedTestFile: "../../testdata/routes.html",
+		},
 	}
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
@@ -2,111 +2,363 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
-	"strings"
+	"log/slog"
+	"net/mail"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sethvargo/go-envconfig"
 )
 
 // Options describes common configuration
 type Options struct {
-	APIAddress        string `env:"API_ADDRESS, required"`
-	ClientID          string `env:"CLIENT_ID, required"`
-	ClientSecret      string `env:"CLIENT_SECRET, required"`
-	OrgPrefix         string `env:"ORG_PREFIX, required"`
-	NotifyDays        int    `env:"NOTIFY_DAYS, default=25"`
-	PurgeDays         int    `env:"PURGE_DAYS, default=30"`
-	MailSender        string `env:"MAIL_SENDER, required"`
-	NotifyMailSubject string `env:"NOTIFY_MAIL_SUBJECT, required"`
-	PurgeMailSubject  string `env:"PURGE_MAIL_SUBJECT, required"`
-	DryRun            bool   `env:"DRY_RUN, default=true"`
-	TimeStartsAt      string `env:"TIME_STARTS_AT"`
-	DisablePurge      bool   `env:"DISABLE_PURGE, default=false"`
-	SandboxQuotaName  string `env:"SANDBOX_QUOTA_NAME, required"`
+	APIAddress             string        `env:"API_ADDRESS"`
+	ClientID               string        `env:"CLIENT_ID"`
+	ClientSecret           string        `env:"CLIENT_SECRET"`
+	ClientSecretFile       string        `env:"CLIENT_SECRET_FILE"`
+	OrgPrefix              string        `env:"ORG_PREFIX"`
+	OrgLabelSelector       string        `env:"ORG_LABEL_SELECTOR"`
+	OrgQuotaName           string        `env:"ORG_QUOTA_NAME"`
+	OrgInclude             []string      `env:"ORG_INCLUDE"`
+	OrgExclude             []string      `env:"ORG_EXCLUDE"`
+	NotifyDays             int           `env:"NOTIFY_DAYS, default=25"`
+	NotifyStageDays        []int         `env:"NOTIFY_STAGES"`
+	PurgeDays              int           `env:"PURGE_DAYS, default=30"`
+	MailSender             string        `env:"MAIL_SENDER, required"`
+	NotifyMailSubject      string        `env:"NOTIFY_MAIL_SUBJECT, required"`
+	FinalNotifyMailSubject string        `env:"FINAL_NOTIFY_MAIL_SUBJECT"`
+	PurgeMailSubject       string        `env:"PURGE_MAIL_SUBJECT, required"`
+	RoutesMailSubject      string        `env:"ROUTES_MAIL_SUBJECT, default=Unused routes removed from your cloud.gov sandbox"`
+	OrphanedRouteDays      int           `env:"ORPHANED_ROUTE_DAYS, default=0"`
+	DryRun                 bool          `env:"DRY_RUN, default=true"`
+	TimeStartsAt           string        `env:"TIME_STARTS_AT"`
+	DisablePurge           bool          `env:"DISABLE_PURGE, default=false"`
+	SandboxQuotaName       string        `env:"SANDBOX_QUOTA_NAME"`
+	PolicyFile             string        `env:"POLICY_FILE"`
+	FoundationsFile        string        `env:"FOUNDATIONS_FILE"`
+	LedgerFile             string        `env:"LEDGER_FILE"`
+	SnapshotDir            string        `env:"SNAPSHOT_DIR"`
+	ExportDir              string        `env:"EXPORT_DIR"`
+	DeleteTimeout          time.Duration `env:"DELETE_TIMEOUT, default=1m"`
+	DeletePollInterval     time.Duration `env:"DELETE_POLL_INTERVAL, default=1s"`
+	DeleteAsync            bool          `env:"DELETE_ASYNC, default=false"`
+	EncryptRecipients      []string      `env:"ENCRYPT_RECIPIENTS"`
+	DecryptIdentityFile    string        `env:"DECRYPT_IDENTITY_FILE"`
+	FirstResourceTypes     []string      `env:"FIRST_RESOURCE_TYPES, default=apps,service_instances"`
+	ClockSource            string        `env:"CLOCK_SOURCE, default=resources"`
+	Concurrency            int           `env:"CONCURRENCY, default=1"`
+	RetryAttempts          int           `env:"RETRY_ATTEMPTS, default=3"`
+	RetryBaseDelay         time.Duration `env:"RETRY_BASE_DELAY, default=1s"`
+	MaxPurgesPerRun        int           `env:"MAX_PURGES_PER_RUN, default=100"`
+	MaxPurgesPerOrg        int           `env:"MAX_PURGES_PER_ORG, default=0"`
+	MaxPurgePercent        float64       `env:"MAX_PURGE_PERCENT, default=25"`
+	AllowMassPurge         bool          `env:"ALLOW_MASS_PURGE, default=false"`
+	NotifySchedule         string        `env:"NOTIFY_SCHEDULE"`
+	PurgeSchedule          string        `env:"PURGE_SCHEDULE"`
+	Port                   int           `env:"PORT, default=8080"`
+	MetricsFile            string        `env:"METRICS_FILE"`
+	LogFormat              string        `env:"LOG_FORMAT, default=json"`
+	LogLevel               string        `env:"LOG_LEVEL, default=info"`
+	LogRedact              string        `env:"LOG_REDACT, default=mask"`
 	SMTPOptions
+
+	// NotifyStages are set from the policy file
+	NotifyStages []NotifyStage
+
+	// Foundations are set from the foundations file
+	Foundations []Foundation
 }
 
 func main() {
-	var opts Options
-	ctx := context.Background()
+	// Stop cleanly between spaces on SIGTERM, e.g. when the platform
+	// restarts the app or the pipeline aborts the task
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	if err := envconfig.Process(ctx, &opts); err != nil {
-		log.Fatalf("error parsing options: %s", err.Error())
+	cmd, err := parseCommand(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-
-	cfClient, err := newCFClient(
-		opts.APIAddress,
-		opts.ClientID,
-		opts.ClientSecret,
-	)
 	if err != nil {
-		log.Fatalf("error creating client: %s", err.Error())
+		log.Fatalf("error parsing command: %s", err.Error())
+	}
+
+	if cmd.Name == commandDecrypt {
+		if err := runDecrypt(cmd); err != nil {
+			log.Fatalf("error decrypting: %s", err.Error())
+		}
+		return
 	}
 
-	orgs, err := listSandboxOrgs(ctx, cfClient, opts.OrgPrefix)
+	if cmd.Name == commandConfigValidate {
+		if err := validateConfig(ctx, cmd, envconfig.OsLookuper()); err != nil {
+			fmt.Fprintf(os.Stderr, "configuration is invalid:\n%s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("configuration is valid")
+		return
+	}
+
+	opts, err := loadOptions(ctx, cmd, envconfig.OsLookuper())
 	if err != nil {
-		log.Fatalf("error getting orgs: %s", err.Error())
+		log.Fatalf("error loading options:\n%s", err.Error())
 	}
 
-	// Build filter of users with email addresses (not service accounts)
-	users, err := cfClient.Users.ListAll(ctx, nil)
+	logger, err := newLogger(opts, os.Stderr)
 	if err != nil {
-		log.Fatalf("error getting users: %s", err.Error())
+		log.Fatalf("error configuring logging: %s", err.Error())
 	}
-	userGUIDs := map[string]bool{}
-	for _, user := range users {
-		if strings.Contains(user.Username, "@") {
-			userGUIDs[user.GUID] = true
+	slog.SetDefault(logger)
+
+	var policy *Policy
+	if opts.PolicyFile != "" {
+		policy, err = loadPolicy(opts.PolicyFile, opts)
+		if err != nil {
+			log.Fatalf("error loading policy: %s", err.Error())
+		}
+		if policy.hasStages() && opts.LedgerFile == "" {
+			log.Fatalf("error loading policy: %s", errStagesNeedLedger.Error())
 		}
 	}
 
-	now := time.Now().Truncate(24 * time.Hour)
+	cipher, err := newArtifactCipher(opts.EncryptRecipients, opts.DecryptIdentityFile)
+	if err != nil {
+		log.Fatalf("error loading encryption keys: %s", err.Error())
+	}
+
+	mailSender := &smtpMailer{
+		options: opts.SMTPOptions,
+	}
 
-	var timeStartsAt time.Time
-	if opts.TimeStartsAt != "" {
-		timeStartsAt, err = time.Parse(time.RFC3339Nano, opts.TimeStartsAt)
+	registry := prometheus.NewRegistry()
+	var runners []*runner
+	for _, foundation := range listFoundations(opts) {
+		r, err := newRunner(foundation.Name, foundationOptions(opts, foundation), policy, cipher, mailSender, registry)
 		if err != nil {
-			log.Fatalf("error parsing time starts at: %s", err.Error())
+			if foundation.Name != "" {
+				log.Fatalf("error setting up foundation %s: %s", foundation.Name, err.Error())
+			}
+			log.Fatalf("%s", err.Error())
 		}
+		runners = append(runners, r)
 	}
 
-	var allPurgeErrors []string
-
-	for _, org := range orgs {
-		log.Printf("getting org resources for org %s", org.Name)
-		spaces, apps, instances, err := listOrgResources(ctx, cfClient, org)
+	switch cmd.Name {
+	case commandPreflight:
+		failed := false
+		for _, r := range runners {
+			ctx := ctx
+			if r.foundation != "" {
+				ctx = withLogAttrs(ctx, "foundation", r.foundation)
+			}
+			if err := r.reloadSecrets(); err != nil {
+				slog.ErrorContext(ctx, "preflight failed", "error", err)
+				failed = true
+				continue
+			}
+			orgs, err := listSandboxOrgs(ctx, r.cfClient, r.opts)
+			if err == nil {
+				err = preflight(ctx, r.cfClient, r.opts, policy, orgs, mailSender)
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "preflight failed", "error", err)
+				failed = true
+				continue
+			}
+			slog.InfoContext(ctx, "preflight checks passed", "orgs", len(orgs))
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	case commandExplain:
+		r, err := selectRunner(runners, cmd.Foundation)
 		if err != nil {
-			log.Fatalf("error listing org resources for org %s: %s", org.Name, err.Error())
+			log.Fatalf("%s", err.Error())
 		}
-
-		toNotify, toPurge, err := listPurgeSpaces(spaces, apps, instances, opts, now, timeStartsAt)
+		if err := r.reloadSecrets(); err != nil {
+			log.Fatalf("%s", err.Error())
+		}
+		orgs, err := listSandboxOrgs(ctx, r.cfClient, r.opts)
 		if err != nil {
-			log.Fatalf("error listing spaces to purge for org %s: %s", org.Name, err.Error())
+			log.Fatalf("error getting orgs: %s", err.Error())
 		}
-
-		mailSender := &smtpMailer{
-			options: opts.SMTPOptions,
+		now := time.Now().Truncate(24 * time.Hour)
+		explanation, err := explainSpace(ctx, r.cfClient, r.opts, policy, orgs, cmd.Org, cmd.Space, now)
+		if err != nil {
+			log.Fatalf("error explaining space %s in org %s: %s", cmd.Space, cmd.Org, err.Error())
 		}
-
-		log.Printf("notifying %d spaces in org %s", len(toNotify), org.Name)
-		for _, details := range toNotify {
-			err = notifySpaceUsers(ctx, cfClient, opts, userGUIDs, org, details, mailSender)
+		if cmd.Format == formatJSON {
+			data, err := json.MarshalIndent(explanation, "", "  ")
 			if err != nil {
-				log.Fatalf("error notifying space %s in org %s: %s", details.Space.Name, org.Name, err)
+				log.Fatalf("error encoding explanation: %s", err.Error())
 			}
+			fmt.Println(string(data))
+		} else {
+			fmt.Print(explanation.text())
 		}
+		return
+	case commandServe:
+		if err := serve(ctx, opts, runners, registry); err != nil {
+			log.Fatalf("error serving: %s", err.Error())
+		}
+		return
+	}
 
-		log.Printf("purging %d spaces in org %s", len(toPurge), org.Name)
-		for _, details := range toPurge {
-			err = purgeAndRecreateSpace(ctx, cfClient, opts, userGUIDs, org, details, mailSender)
-			if err != nil {
-				allPurgeErrors = append(allPurgeErrors, err.Error())
-			}
+	runs := runFoundations(ctx, runners, cmd)
+	if opts.MetricsFile != "" {
+		if err := prometheus.WriteToTextfile(opts.MetricsFile, registry); err != nil {
+			slog.ErrorContext(ctx, "error writing metrics", "error", err)
 		}
 	}
+	if len(runs) == 1 && runs[0].Foundation == "" {
+		// A single foundation fails the way it always has
+		if runs[0].Error != "" {
+			log.Fatalf("%s", runs[0].Error)
+		}
+		if runs[0].Summary == nil {
+			return
+		}
+	}
+	logFoundationRuns(ctx, runs)
+	os.Exit(foundationsExitCode(runs))
+}
 
-	if len(allPurgeErrors) > 0 {
-		log.Fatalf("error(s) purging sandboxes: %s", strings.Join(allPurgeErrors, ", "))
+// selectRunner picks the foundation named on the command line, which is
+// required when FOUNDATIONS_FILE lists several
+func selectRunner(runners []*runner, foundation string) (*runner, error) {
+	if foundation == "" && len(runners) == 1 {
+		return runners[0], nil
+	}
+	for _, r := range runners {
+		if foundation != "" && r.foundation == foundation {
+			return r, nil
+		}
+	}
+	if foundation == "" {
+		return nil, errors.New("--foundation is required when FOUNDATIONS_FILE is set")
+	}
+	return nil, fmt.Errorf("unknown foundation %q", foundation)
+}
+
+// runDecrypt decrypts a file for the decrypt command
+func runDecrypt(cmd cliCommand) error {
+	if cmd.OutputFile == "" {
+		return decryptFile(cmd.IdentityFile, cmd.InputFile, os.Stdout)
+	}
+	f, err := os.OpenFile(cmd.OutputFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", cmd.OutputFile, err)
+	}
+	defer f.Close()
+	if err := decryptFile(cmd.IdentityFile, cmd.InputFile, f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// validateOptions checks options that envconfig can't validate on its own,
+// reporting every problem found rather than only the first
+func validateOptions(opts Options) error {
+	var problems []error
+
+	if _, err := parseTimeStartsAt(opts.TimeStartsAt); err != nil {
+		problems = append(problems, fmt.Errorf("error parsing time starts at: %w", err))
+	}
+
+	if err := validateResourceTypes(opts.FirstResourceTypes); err != nil {
+		problems = append(problems, fmt.Errorf("error parsing first resource types: %w", err))
+	}
+
+	if err := validateClockSource(opts.ClockSource); err != nil {
+		problems = append(problems, fmt.Errorf("error parsing clock source: %w", err))
+	}
+
+	if err := validateFoundationOptions(opts); err != nil {
+		problems = append(problems, err)
+	}
+
+	if opts.SMTPPass == "" {
+		problems = append(problems, fmt.Errorf("SMTP_PASS or SMTP_PASS_FILE is required"))
+	}
+
+	if opts.PurgeDays < 1 {
+		problems = append(problems, fmt.Errorf("PURGE_DAYS must be at least 1, got %d", opts.PurgeDays))
+	}
+
+	if len(opts.NotifyStageDays) == 0 && opts.NotifyDays >= opts.PurgeDays {
+		problems = append(problems, fmt.Errorf("NOTIFY_DAYS (%d) must be less than PURGE_DAYS (%d)", opts.NotifyDays, opts.PurgeDays))
+	}
+
+	if opts.OrphanedRouteDays < 0 {
+		problems = append(problems, fmt.Errorf("ORPHANED_ROUTE_DAYS must not be negative, got %d", opts.OrphanedRouteDays))
+	}
+
+	// A missing MAIL_SENDER is reported when the options are read
+	if _, err := mail.ParseAddress(opts.MailSender); opts.MailSender != "" && err != nil {
+		problems = append(problems, fmt.Errorf("MAIL_SENDER %q is not a valid email address: %w", opts.MailSender, err))
+	}
+
+	if opts.SMTPPort < 1 || opts.SMTPPort > 65535 {
+		problems = append(problems, fmt.Errorf("SMTP_PORT must be between 1 and 65535, got %d", opts.SMTPPort))
+	}
+
+	if opts.Port < 1 || opts.Port > 65535 {
+		problems = append(problems, fmt.Errorf("PORT must be between 1 and 65535, got %d", opts.Port))
+	}
+
+	if opts.MaxPurgesPerRun < 0 || opts.MaxPurgesPerOrg < 0 {
+		problems = append(problems, fmt.Errorf("purge limits must not be negative"))
+	}
+
+	if opts.MaxPurgePercent < 0 || opts.MaxPurgePercent > 100 {
+		problems = append(problems, fmt.Errorf("max purge percent must be between 0 and 100, got %g", opts.MaxPurgePercent))
+	}
+
+	if opts.DeleteTimeout <= 0 || opts.DeletePollInterval <= 0 {
+		problems = append(problems, fmt.Errorf("delete timeout and poll interval must be positive"))
+	}
+
+	if opts.DeleteAsync && opts.SnapshotDir == "" {
+		problems = append(problems, fmt.Errorf("DELETE_ASYNC requires SNAPSHOT_DIR to record unfinished delete jobs"))
+	}
+
+	if opts.SnapshotDir != "" && len(opts.EncryptRecipients) > 0 && opts.DecryptIdentityFile == "" {
+		problems = append(problems, fmt.Errorf("SNAPSHOT_DIR with ENCRYPT_RECIPIENTS requires DECRYPT_IDENTITY_FILE to read snapshots back"))
+	}
+
+	if opts.RetryAttempts < 1 || opts.RetryBaseDelay < 0 {
+		problems = append(problems, fmt.Errorf("retry attempts must be at least 1 and the base delay must not be negative"))
+	}
+
+	if opts.Concurrency < 1 {
+		problems = append(problems, fmt.Errorf("concurrency must be at least 1, got %d", opts.Concurrency))
+	}
+
+	if _, err := parseSchedules(opts); err != nil {
+		problems = append(problems, err)
+	}
+
+	if _, err := newLogger(opts, io.Discard); err != nil {
+		problems = append(problems, err)
+	}
+
+	if len(opts.NotifyStageDays) > 0 {
+		if err := validateNotifyStages(listNotifyStages(opts)); err != nil {
+			problems = append(problems, fmt.Errorf("error parsing notify stages: %w", err))
+		}
+		if opts.LedgerFile == "" {
+			problems = append(problems, errStagesNeedLedger)
+		}
 	}
+	return errors.Join(problems...)
 }
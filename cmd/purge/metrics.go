@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "purge_sandboxes"
+
+// Steps of purgeAndRecreateSpace, used to label purge failures
+const (
+	purgeStageExport   = "export"
+	purgeStageEmail    = "email"
+	purgeStageSnapshot = "snapshot"
+	purgeStageDelete   = "delete"
+	purgeStageWait     = "wait"
+	purgeStageRecreate = "recreate"
+	purgeStageRoles    = "roles"
+)
+
+// purgeStageError records which step of a purge failed
+type purgeStageError struct {
+	stage string
+	err   error
+}
+
+func (e *purgeStageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *purgeStageError) Unwrap() error {
+	return e.err
+}
+
+// runMetrics counts what each run scanned, notified, purged and failed; in
+// daemon mode the counters accumulate across scheduled runs
+type runMetrics struct {
+	registry       *prometheus.Registry
+	spacesScanned  *prometheus.CounterVec
+	spacesNotified *prometheus.CounterVec
+	spacesPurged   *prometheus.CounterVec
+	purgeFailures  *prometheus.CounterVec
+	emails         *prometheus.CounterVec
+	spaceAge       prometheus.Histogram
+	lastRun        prometheus.Gauge
+}
+
+func newRunMetrics() *runMetrics {
+	return newFoundationMetrics(prometheus.NewRegistry(), "")
+}
+
+// newFoundationMetrics registers a foundation's metrics on a registry shared
+// by every foundation, labelled with the foundation's name if it has one
+func newFoundationMetrics(registry *prometheus.Registry, foundation string) *runMetrics {
+	var registerer prometheus.Registerer = registry
+	if foundation != "" {
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels{"foundation": foundation}, registry)
+	}
+	m := &runMetrics{
+		registry: registry,
+		spacesScanned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "spaces_scanned_total",
+			Help:      "Spaces checked for age, by org.",
+		}, []string{"org"}),
+		spacesNotified: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "spaces_notified_total",
+			Help:      "Spaces whose users were sent a reminder, by org.",
+		}, []string{"org"}),
+		spacesPurged: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "spaces_purged_total",
+			Help:      "Spaces purged and recreated, by org.",
+		}, []string{"org"}),
+		purgeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "purge_failures_total",
+			Help:      "Failed purges, by org and the step that failed.",
+		}, []string{"org", "stage"}),
+		emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "emails_total",
+			Help:      "Emails sent, by result: sent or failed.",
+		}, []string{"result"}),
+		spaceAge: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "space_age_days",
+			Help:      "Age in days of spaces planned for a reminder or purge.",
+			Buckets:   []float64{1, 7, 14, 21, 25, 28, 30, 45, 60, 90},
+		}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Time the last run finished.",
+		}),
+	}
+	registerer.MustRegister(
+		m.spacesScanned,
+		m.spacesNotified,
+		m.spacesPurged,
+		m.purgeFailures,
+		m.emails,
+		m.spaceAge,
+		m.lastRun,
+	)
+	return m
+}
+
+// observeRun records a finished run; dry runs count scanned spaces and ages
+// but not notifications or purges, since nothing was changed
+func (m *runMetrics) observeRun(plan *Plan, results []actionResult, dryRun bool, now time.Time) {
+	for _, org := range plan.Orgs {
+		m.spacesScanned.WithLabelValues(org.Org.Name).Add(float64(org.SpaceCount))
+		for _, action := range org.Actions {
+			if action.Action == actionNotify || action.Action == actionPurge {
+				m.spaceAge.Observe(now.Sub(action.Timestamp).Hours() / 24)
+			}
+		}
+	}
+
+	for _, result := range results {
+		if errors.Is(result.Err, ErrSpaceDeletePending) || errors.Is(result.Err, ErrAlreadyNotified) {
+			continue
+		}
+		if result.Err != nil {
+			if result.Action == actionPurge {
+				stage := "other"
+				var stageErr *purgeStageError
+				if errors.As(result.Err, &stageErr) {
+					stage = stageErr.stage
+				}
+				m.purgeFailures.WithLabelValues(result.Org, stage).Inc()
+			}
+			continue
+		}
+		if dryRun {
+			continue
+		}
+		switch result.Action {
+		case actionNotify:
+			m.spacesNotified.WithLabelValues(result.Org).Inc()
+		case actionPurge:
+			m.spacesPurged.WithLabelValues(result.Org).Inc()
+		}
+	}
+	m.lastRun.Set(float64(now.Unix()))
+}
+
+// metricsMailer counts emails sent through another mailer
+type metricsMailer struct {
+	mailer
+	emails *prometheus.CounterVec
+}
+
+func (m *metricsMailer) sendMail(
+	opts SMTPOptions,
+	sender string,
+	subject string,
+	body string,
+	recipients []string,
+) error {
+	err := m.mailer.sendMail(opts, sender, subject, body, recipients)
+	if len(recipients) == 0 {
+		return err
+	}
+	if err != nil {
+		m.emails.WithLabelValues("failed").Inc()
+	} else {
+		m.emails.WithLabelValues("sent").Inc()
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type failingMailSender struct{}
+
+func (m *failingMailSender) sendMail(
+	opts SMTPOptions,
+	sender string,
+	subject string,
+	body string,
+	recipients []string,
+) error {
+	return errors.New("smtp error")
+}
+
+func TestObserveRun(t *testing.T) {
+	now := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	plan := newTestPlan(nil)
+	plan.Orgs[0].SpaceCount = 3
+	plan.Orgs[0].Actions = append(plan.Orgs[0].Actions, PlanAction{Action: actionNotify, Timestamp: now.AddDate(0, 0, -25)})
+
+	results := []actionResult{
+		{Org: "org", Space: "space", Action: actionPurge, Err: &purgeStageError{stage: purgeStageWait, err: errors.New("timed out")}},
+		{Org: "org", Space: "other", Action: actionPurge, Err: fmt.Errorf("wrapped: %w", &purgeStageError{stage: purgeStageRoles, err: errors.New("boom")})},
+		{Org: "org", Space: "notified", Action: actionNotify},
+		{Org: "org", Space: "reminded", Action: actionNotify, Err: fmt.Errorf("wrapped: %w", ErrAlreadyNotified)},
+		{Org: "org", Space: "deleting", Action: actionPurge, Err: ErrSpaceDeletePending},
+	}
+
+	testCases := map[string]struct {
+		dryRun           bool
+		expectedNotified float64
+	}{
+		"counts notifications": {
+			expectedNotified: 1,
+		},
+		"dry runs don't count notifications": {
+			dryRun: true,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			metrics := newRunMetrics()
+			metrics.observeRun(plan, results, test.dryRun, now)
+
+			if got := testutil.ToFloat64(metrics.spacesScanned.WithLabelValues("org")); got != 3 {
+				t.Errorf("expected 3 spaces scanned, got %g", got)
+			}
+			if got := testutil.ToFloat64(metrics.spacesNotified.WithLabelValues("org")); got != test.expectedNotified {
+				t.Errorf("expected %g spaces notified, got %g", test.expectedNotified, got)
+			}
+			for _, stage := range []string{purgeStageWait, purgeStageRoles} {
+				if got := testutil.ToFloat64(metrics.purgeFailures.WithLabelValues("org", stage)); got != 1 {
+					t.Errorf("expected 1 %s failure, got %g", stage, got)
+				}
+			}
+			if got := testutil.ToFloat64(metrics.spacesPurged.WithLabelValues("org")); got != 0 {
+				t.Errorf("expected pending deletes not to count as purged, got %g", got)
+			}
+			if got := testutil.CollectAndCount(metrics.purgeFailures); got != 2 {
+				t.Errorf("expected pending deletes not to count as failures, got %d failure series", got)
+			}
+			if got := testutil.CollectAndCount(metrics.spaceAge); got != 1 {
+				t.Errorf("expected space age histogram, got %d metrics", got)
+			}
+		})
+	}
+}
+
+func TestObserveRunSkipsSpacesAlreadyNotified(t *testing.T) {
+	ledger, err := loadNotifyLedger(filepath.Join(t.TempDir(), "ledger.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	plan := newTestPlan(func(action *PlanAction) {
+		action.Action = actionNotify
+		action.Stage = &NotifyStage{Name: "notify", Template: defaultNotifyTemplate}
+	})
+
+	metrics := newRunMetrics()
+	for range 3 {
+		results := applyPlan(context.Background(), &cfResourceClient{}, Options{Concurrency: 1}, nil, plan, ledger, nil, nil, &mockMailSender{})
+		metrics.observeRun(plan, results, false, time.Now())
+	}
+	if got := testutil.ToFloat64(metrics.spacesNotified.WithLabelValues("org")); got != 1 {
+		t.Errorf("expected 1 space notified across runs, got %g", got)
+	}
+}
+
+func TestMetricsMailer(t *testing.T) {
+	metrics := newRunMetrics()
+	sent := &metricsMailer{mailer: &mockMailSender{}, emails: metrics.emails}
+	failed := &metricsMailer{mailer: &failingMailSender{}, emails: metrics.emails}
+
+	sent.sendMail(SMTPOptions{}, "sender", "subject", "body", []string{"foo@bar.gov"})
+	sent.sendMail(SMTPOptions{}, "sender", "subject", "body", nil)
+	failed.sendMail(SMTPOptions{}, "sender", "subject", "body", []string{"foo@bar.gov"})
+
+	if got := testutil.ToFloat64(metrics.emails.WithLabelValues("sent")); got != 1 {
+		t.Errorf("expected 1 email sent, got %g", got)
+	}
+	if got := testutil.ToFloat64(metrics.emails.WithLabelValues("failed")); got != 1 {
+		t.Errorf("expected 1 email failed, got %g", got)
+	}
+
+	filename := filepath.Join(t.TempDir(), "purge.prom")
+	if err := prometheus.WriteToTextfile(filename, metrics.registry); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(string(contents), `purge_sandboxes_emails_total{result="sent"} 1`) {
+		t.Errorf("expected textfile to include email counts, got:\n%s", contents)
+	}
+}
+
+func TestFoundationMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	east := newFoundationMetrics(registry, "east")
+	west := newFoundationMetrics(registry, "west")
+	east.spacesPurged.WithLabelValues("sandbox-gsa").Inc()
+	west.spacesPurged.WithLabelValues("sandbox-gsa").Add(2)
+
+	expected := `
+# HELP purge_sandboxes_spaces_purged_total Spaces purged and recreated, by org.
+# TYPE purge_sandboxes_spaces_purged_total counter
+purge_sandboxes_spaces_purged_total{foundation="east",org="sandbox-gsa"} 1
+purge_sandboxes_spaces_purged_total{foundation="west",org="sandbox-gsa"} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "purge_sandboxes_spaces_purged_total"); err != nil {
+		t.Error(err)
+	}
+}
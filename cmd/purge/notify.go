@@ -2,39 +2,41 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
 )
 
+// ErrAlreadyNotified means the ledger shows the space was already notified
+// for its current stage, so no email was sent
+var ErrAlreadyNotified = errors.New("space already notified for this stage")
+
 func notifySpaceUsers(
 	ctx context.Context,
-	cfClient *cfResourceClient,
 	opts Options,
-	userGUIDs map[string]bool,
 	org *resource.Organization,
 	details SpaceDetails,
+	members spaceMembers,
 	mailSender mailer,
+	ledger *notifyLedger,
 ) error {
-	notifyTemplate, err := template.ParseFiles("../../templates/base.html", "../../templates/notify.tmpl")
-	if err != nil {
-		return fmt.Errorf("error reading notify template: %w", err)
+	stage := details.Stage
+	if ledger.hasNotified(details) {
+		slog.InfoContext(ctx, "skipping space already notified for this stage", "space", details.Space.Name, "stage", stage.Name)
+		return ErrAlreadyNotified
 	}
 
-	spaceUsers, err := cfClient.Spaces.ListUsersAll(ctx, details.Space.GUID, nil)
+	notifyTemplate, err := template.ParseFiles("../../templates/base.html", "../../templates/"+stage.Template)
 	if err != nil {
-		return fmt.Errorf("error listing users on space %s: %w", details.Space.Name, err)
+		return fmt.Errorf("error reading notify template %s: %w", stage.Template, err)
 	}
 
-	recipients, err := listRecipients(userGUIDs, spaceUsers)
-	if err != nil {
-		return fmt.Errorf("error listing recipients on space %s: %w", details.Space.Name, err)
-	}
-
-	log.Printf("Notifying space %s; recipients %+v", details.Space.Name, recipients)
+	recipients := members.Recipients
+	slog.InfoContext(ctx, "notifying space", "space", details.Space.Name, "stage", stage.Name, "recipients", recipients)
 	if opts.DryRun {
 		return nil
 	}
@@ -44,6 +46,7 @@ func notifySpaceUsers(
 		"space": details.Space,
 		"date":  details.Timestamp.Add(24 * time.Duration(opts.PurgeDays) * time.Hour),
 		"days":  opts.PurgeDays,
+		"stage": stage.Name,
 	}
 
 	body, err := renderTemplate(notifyTemplate, data)
@@ -51,11 +54,16 @@ func notifySpaceUsers(
 		return fmt.Errorf("error rendering email: %w", err)
 	}
 
-	log.Printf("sending to %s: %s", recipients, body)
+	slog.InfoContext(ctx, "sending email", "subject", stage.Subject, "recipients", recipients)
+	slog.DebugContext(ctx, "email body", "body", body)
 
-	if err := mailSender.sendMail(opts.SMTPOptions, opts.MailSender, opts.NotifyMailSubject, body, recipients); err != nil {
+	if err := mailSender.sendMail(opts.SMTPOptions, opts.MailSender, stage.Subject, body, recipients); err != nil {
 		return fmt.Errorf("error sending mail on space %s: %w", details.Space.Name, err)
 	}
 
+	if err := ledger.recordNotified(details); err != nil {
+		return fmt.Errorf("error recording notification for space %s in ledger: %w", details.Space.Name, err)
+	}
+
 	return nil
 }
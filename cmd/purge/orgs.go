@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+// orgGUIDBatchSize caps how many GUIDs go in one org list request, to keep
+// URLs short
+const orgGUIDBatchSize = 100
+
+var (
+	labelSetPattern = regexp.MustCompile(`^([^\s!=]+)\s+(in|notin)\s*\(([^)]*)\)$`)
+	labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+)
+
+// parseLabelSelector parses a CF label selector such as
+// "sandbox=true,env in (dev,test),!legacy"; an empty selector returns nil
+func parseLabelSelector(selector string) (client.LabelSelector, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, nil
+	}
+
+	// Split on commas outside parentheses
+	var requirements []string
+	depth, start := 0, 0
+	for i, r := range selector {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				requirements = append(requirements, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	requirements = append(requirements, selector[start:])
+
+	labels := client.LabelSelector{}
+	for _, requirement := range requirements {
+		requirement = strings.TrimSpace(requirement)
+		var key string
+		var filter client.ExclusionFilter
+		if match := labelSetPattern.FindStringSubmatch(requirement); match != nil {
+			key = match[1]
+			for _, value := range strings.Split(match[3], ",") {
+				filter.Values = append(filter.Values, strings.TrimSpace(value))
+			}
+			filter.Not = match[2] == "notin"
+		} else if k, v, ok := strings.Cut(requirement, "!="); ok {
+			key, filter = k, client.ExclusionFilter{Filter: client.Filter{Values: []string{v}}, Not: true}
+		} else if k, v, ok := strings.Cut(requirement, "=="); ok {
+			key, filter = k, client.ExclusionFilter{Filter: client.Filter{Values: []string{v}}}
+		} else if k, v, ok := strings.Cut(requirement, "="); ok {
+			key, filter = k, client.ExclusionFilter{Filter: client.Filter{Values: []string{v}}}
+		} else if k, ok := strings.CutPrefix(requirement, "!"); ok {
+			key, filter = k, client.ExclusionFilter{Not: true}
+		} else {
+			key = requirement
+		}
+
+		key = strings.TrimSpace(key)
+		if !labelKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid label selector %q: bad requirement %q", selector, requirement)
+		}
+		// The CF API takes one filter per key, so a second requirement would
+		// silently replace the first
+		if _, ok := labels[key]; ok {
+			return nil, fmt.Errorf("invalid label selector %q: key %s is used more than once", selector, key)
+		}
+		for i, value := range filter.Values {
+			filter.Values[i] = strings.TrimSpace(value)
+		}
+		labels[key] = filter
+	}
+	return labels, nil
+}
+
+// validateOrgSelection checks that some way of picking sandbox orgs is set
+func validateOrgSelection(opts Options) []error {
+	var problems []error
+	if opts.OrgPrefix == "" && opts.OrgLabelSelector == "" && opts.OrgQuotaName == "" && len(opts.OrgInclude) == 0 {
+		problems = append(problems, errors.New("one of ORG_PREFIX, ORG_LABEL_SELECTOR, ORG_QUOTA_NAME or ORG_INCLUDE is required"))
+	}
+	if _, err := parseLabelSelector(opts.OrgLabelSelector); err != nil {
+		problems = append(problems, err)
+	}
+	excluded := map[string]bool{}
+	for _, name := range opts.OrgExclude {
+		excluded[name] = true
+	}
+	for _, name := range opts.OrgInclude {
+		if excluded[name] {
+			problems = append(problems, fmt.Errorf("org %s is listed in both ORG_INCLUDE and ORG_EXCLUDE", name))
+		}
+	}
+	return problems
+}
+
+// describeOrgSelection lists the configured org selectors, for messages
+// about which orgs were picked
+func describeOrgSelection(opts Options) string {
+	var selectors []string
+	if opts.OrgPrefix != "" {
+		selectors = append(selectors, fmt.Sprintf("ORG_PREFIX %q", opts.OrgPrefix))
+	}
+	if opts.OrgLabelSelector != "" {
+		selectors = append(selectors, fmt.Sprintf("ORG_LABEL_SELECTOR %q", opts.OrgLabelSelector))
+	}
+	if opts.OrgQuotaName != "" {
+		selectors = append(selectors, fmt.Sprintf("ORG_QUOTA_NAME %q", opts.OrgQuotaName))
+	}
+	if len(opts.OrgInclude) > 0 {
+		selectors = append(selectors, fmt.Sprintf("ORG_INCLUDE %q", strings.Join(opts.OrgInclude, ",")))
+	}
+	if len(opts.OrgExclude) > 0 {
+		selectors = append(selectors, fmt.Sprintf("ORG_EXCLUDE %q", strings.Join(opts.OrgExclude, ",")))
+	}
+	return strings.Join(selectors, ", ")
+}
+
+// listSandboxOrgs lists the sandbox orgs, logging a warning for each org the
+// configured selectors disagree on
+func listSandboxOrgs(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+) ([]*resource.Organization, error) {
+	orgs, warnings, err := selectSandboxOrgs(ctx, cfClient, opts)
+	for _, warning := range warnings {
+		slog.WarnContext(ctx, warning)
+	}
+	return orgs, err
+}
+
+// selectSandboxOrgs picks sandbox orgs by ORG_PREFIX, ORG_LABEL_SELECTOR and
+// ORG_QUOTA_NAME, which must all match, plus ORG_INCLUDE and minus
+// ORG_EXCLUDE. Orgs are fetched by label, quota or name on the server where
+// possible. An org that matches some selectors but not others is skipped
+// with a warning, and an included org that doesn't match is kept with one.
+func selectSandboxOrgs(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+) ([]*resource.Organization, []string, error) {
+	labels, err := parseLabelSelector(opts.OrgLabelSelector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var quotaOrgs map[string]bool
+	if opts.OrgQuotaName != "" {
+		quotaOrgs, err = listQuotaOrgGUIDs(ctx, cfClient, opts.OrgQuotaName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting org quota %s: %w", opts.OrgQuotaName, err)
+		}
+	}
+
+	var candidates []*resource.Organization
+	labelled := map[string]bool{}
+	switch {
+	case labels != nil:
+		listOpts := client.NewOrganizationListOptions()
+		listOpts.LabelSel = labels
+		candidates, err = cfClient.Organizations.ListAll(ctx, listOpts)
+		for _, org := range candidates {
+			labelled[org.GUID] = true
+		}
+	case quotaOrgs != nil:
+		candidates, err = listOrgsByGUID(ctx, cfClient, quotaOrgs)
+	case opts.OrgPrefix != "":
+		candidates, err = cfClient.Organizations.ListAll(ctx, nil)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	included := map[string]bool{}
+	if len(opts.OrgInclude) > 0 {
+		listOpts := client.NewOrganizationListOptions()
+		listOpts.Names = client.Filter{Values: opts.OrgInclude}
+		orgs, err := cfClient.Organizations.ListAll(ctx, listOpts)
+		if err != nil {
+			return nil, nil, err
+		}
+		seen := map[string]bool{}
+		for _, org := range candidates {
+			seen[org.GUID] = true
+		}
+		for _, org := range orgs {
+			included[org.Name] = true
+			if !seen[org.GUID] {
+				candidates = append(candidates, org)
+			}
+		}
+		for _, name := range opts.OrgInclude {
+			if !included[name] {
+				warnings = append(warnings, fmt.Sprintf("ORG_INCLUDE lists org %s, which doesn't exist", name))
+			}
+		}
+	}
+
+	excluded := map[string]bool{}
+	for _, name := range opts.OrgExclude {
+		excluded[name] = false
+	}
+
+	sandboxes := []*resource.Organization{}
+	for _, org := range candidates {
+		var matched, missed []string
+		check := func(selector string, ok bool) {
+			if ok {
+				matched = append(matched, selector)
+			} else {
+				missed = append(missed, selector)
+			}
+		}
+		if opts.OrgPrefix != "" {
+			check("ORG_PREFIX", strings.HasPrefix(org.Name, opts.OrgPrefix))
+		}
+		if labels != nil {
+			check("ORG_LABEL_SELECTOR", labelled[org.GUID])
+		}
+		if quotaOrgs != nil {
+			check("ORG_QUOTA_NAME", quotaOrgs[org.GUID])
+		}
+
+		if _, ok := excluded[org.Name]; ok {
+			excluded[org.Name] = len(missed) == 0 || included[org.Name]
+			continue
+		}
+		if len(missed) > 0 {
+			if included[org.Name] {
+				warnings = append(warnings, fmt.Sprintf("including org %s from ORG_INCLUDE, though it doesn't match %s", org.Name, strings.Join(missed, " or ")))
+			} else {
+				if len(matched) > 0 {
+					warnings = append(warnings, fmt.Sprintf("skipping org %s: it matches %s but not %s", org.Name, strings.Join(matched, " and "), strings.Join(missed, " or ")))
+				}
+				continue
+			}
+		}
+		sandboxes = append(sandboxes, org)
+	}
+
+	// Orgs on the sandbox quota that the label selector didn't return were
+	// never candidates, so check for them separately
+	if labels != nil && quotaOrgs != nil {
+		var unlabelled []string
+		for guid := range quotaOrgs {
+			if !labelled[guid] {
+				unlabelled = append(unlabelled, guid)
+			}
+		}
+		sort.Strings(unlabelled)
+		for _, guid := range unlabelled {
+			warnings = append(warnings, fmt.Sprintf("skipping org %s: it uses org quota %s but doesn't match ORG_LABEL_SELECTOR", guid, opts.OrgQuotaName))
+		}
+	}
+
+	for _, name := range opts.OrgExclude {
+		if !excluded[name] {
+			warnings = append(warnings, fmt.Sprintf("ORG_EXCLUDE lists org %s, which isn't selected anyway", name))
+		}
+	}
+	return sandboxes, warnings, nil
+}
+
+// listQuotaOrgGUIDs returns the GUIDs of the orgs an org quota is applied to
+func listQuotaOrgGUIDs(ctx context.Context, cfClient *cfResourceClient, name string) (map[string]bool, error) {
+	listOpts := client.NewOrganizationQuotaListOptions()
+	listOpts.Names = client.Filter{Values: []string{name}}
+	quota, err := cfClient.OrganizationQuotas.Single(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	guids := map[string]bool{}
+	for _, org := range quota.Relationships.Organizations.Data {
+		guids[org.GUID] = true
+	}
+	return guids, nil
+}
+
+// listOrgsByGUID fetches orgs by GUID in batches, in GUID order
+func listOrgsByGUID(ctx context.Context, cfClient *cfResourceClient, guids map[string]bool) ([]*resource.Organization, error) {
+	sorted := make([]string, 0, len(guids))
+	for guid := range guids {
+		sorted = append(sorted, guid)
+	}
+	sort.Strings(sorted)
+
+	orgs := []*resource.Organization{}
+	for start := 0; start < len(sorted); start += orgGUIDBatchSize {
+		listOpts := client.NewOrganizationListOptions()
+		listOpts.GUIDs = client.Filter{Values: sorted[start:min(start+orgGUIDBatchSize, len(sorted))]}
+		batch, err := cfClient.Organizations.ListAll(ctx, listOpts)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, batch...)
+	}
+	return orgs, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockOrganizationQuotas struct {
+	quotas map[string][]string
+}
+
+func (q *mockOrganizationQuotas) Single(ctx context.Context, opts *client.OrganizationQuotaListOptions) (*resource.OrganizationQuota, error) {
+	guids, ok := q.quotas[opts.Names.Values[0]]
+	if !ok {
+		return nil, client.ErrNoResultsReturned
+	}
+	quota := &resource.OrganizationQuota{Name: opts.Names.Values[0]}
+	for _, guid := range guids {
+		quota.Relationships.Organizations.Data = append(quota.Relationships.Organizations.Data, resource.Relationship{GUID: guid})
+	}
+	return quota, nil
+}
+
+func TestParseLabelSelector(t *testing.T) {
+	testCases := map[string]struct {
+		selector      string
+		expected      client.LabelSelector
+		expectedError bool
+	}{
+		"empty": {
+			selector: "",
+		},
+		"equality and existence": {
+			selector: "sandbox=true, tier==free,env!=prod,owner,!legacy",
+			expected: client.LabelSelector{
+				"sandbox": {Filter: client.Filter{Values: []string{"true"}}},
+				"tier":    {Filter: client.Filter{Values: []string{"free"}}},
+				"env":     {Filter: client.Filter{Values: []string{"prod"}}, Not: true},
+				"owner":   {},
+				"legacy":  {Not: true},
+			},
+		},
+		"sets": {
+			selector: "env in (dev, test),cloud.gov/team notin (ops)",
+			expected: client.LabelSelector{
+				"env":            {Filter: client.Filter{Values: []string{"dev", "test"}}},
+				"cloud.gov/team": {Filter: client.Filter{Values: []string{"ops"}}, Not: true},
+			},
+		},
+		"bad key": {
+			selector:      "sandbox=true,=free",
+			expectedError: true,
+		},
+		"repeated key": {
+			selector:      "env!=prod,env!=staging",
+			expectedError: true,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseLabelSelector(test.selector)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, got); diff != "" {
+				t.Errorf("unexpected selector (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSelectSandboxOrgs(t *testing.T) {
+	cfClient := &cfResourceClient{
+		Organizations: &mockOrganizations{
+			orgs: []*resource.Organization{
+				{Name: "sandbox-a", GUID: "a"},
+				{Name: "sandbox-b", GUID: "b"},
+				{Name: "team-c", GUID: "c"},
+				{Name: "other-d", GUID: "d"},
+			},
+			labelled: []string{"a", "c"},
+		},
+		OrganizationQuotas: &mockOrganizationQuotas{
+			quotas: map[string][]string{"sandbox-orgs": {"a", "b"}},
+		},
+	}
+
+	testCases := map[string]struct {
+		opts             Options
+		expected         []string
+		expectedWarnings []string
+	}{
+		"prefix": {
+			opts:     Options{OrgPrefix: "sandbox-"},
+			expected: []string{"sandbox-a", "sandbox-b"},
+		},
+		"prefix and label selector": {
+			opts:     Options{OrgPrefix: "sandbox-", OrgLabelSelector: "sandbox=true"},
+			expected: []string{"sandbox-a"},
+			expectedWarnings: []string{
+				"skipping org team-c: it matches ORG_LABEL_SELECTOR but not ORG_PREFIX",
+			},
+		},
+		"org quota": {
+			opts:     Options{OrgQuotaName: "sandbox-orgs"},
+			expected: []string{"sandbox-a", "sandbox-b"},
+		},
+		"label selector and org quota": {
+			opts:     Options{OrgLabelSelector: "sandbox=true", OrgQuotaName: "sandbox-orgs"},
+			expected: []string{"sandbox-a"},
+			expectedWarnings: []string{
+				"skipping org team-c: it matches ORG_LABEL_SELECTOR but not ORG_QUOTA_NAME",
+				"skipping org b: it uses org quota sandbox-orgs but doesn't match ORG_LABEL_SELECTOR",
+			},
+		},
+		"include and exclude": {
+			opts: Options{
+				OrgPrefix:  "sandbox-",
+				OrgInclude: []string{"other-d", "missing"},
+				OrgExclude: []string{"sandbox-b", "team-c"},
+			},
+			expected: []string{"sandbox-a", "other-d"},
+			expectedWarnings: []string{
+				"ORG_INCLUDE lists org missing, which doesn't exist",
+				"including org other-d from ORG_INCLUDE, though it doesn't match ORG_PREFIX",
+				"ORG_EXCLUDE lists org team-c, which isn't selected anyway",
+			},
+		},
+		"include only": {
+			opts:     Options{OrgInclude: []string{"team-c"}},
+			expected: []string{"team-c"},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			orgs, warnings, err := selectSandboxOrgs(context.Background(), cfClient, test.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var names []string
+			for _, org := range orgs {
+				names = append(names, org.Name)
+			}
+			if diff := cmp.Diff(test.expected, names); diff != "" {
+				t.Errorf("unexpected orgs (-expected +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.expectedWarnings, warnings); diff != "" {
+				t.Errorf("unexpected warnings (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDescribeOrgSelection(t *testing.T) {
+	testCases := map[string]struct {
+		opts     Options
+		expected string
+	}{
+		"prefix": {
+			opts:     Options{OrgPrefix: "sandbox-"},
+			expected: `ORG_PREFIX "sandbox-"`,
+		},
+		"every selector": {
+			opts: Options{
+				OrgLabelSelector: "sandbox=true",
+				OrgQuotaName:     "sandbox-orgs",
+				OrgInclude:       []string{"team-a", "team-b"},
+				OrgExclude:       []string{"team-c"},
+			},
+			expected: `ORG_LABEL_SELECTOR "sandbox=true", ORG_QUOTA_NAME "sandbox-orgs", ORG_INCLUDE "team-a,team-b", ORG_EXCLUDE "team-c"`,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := describeOrgSelection(test.opts); got != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+const (
+	actionNotify       = "notify"
+	actionPurge        = "purge"
+	actionDeleteRoutes = "delete_routes"
+)
+
+// Plan describes the actions a run will take, so they can be reviewed before
+// they are applied
+type Plan struct {
+	CreatedAt time.Time `json:"created_at"`
+	Orgs      []PlanOrg `json:"orgs"`
+}
+
+// PlanOrg describes the actions planned for a single org
+type PlanOrg struct {
+	Org        *resource.Organization `json:"org"`
+	Profile    string                 `json:"profile,omitempty"`
+	SpaceCount int                    `json:"space_count"`
+	Actions    []PlanAction           `json:"actions"`
+	Errors     []string               `json:"errors,omitempty"`
+}
+
+// PlanAction describes a notify, purge or route deletion for a single space
+type PlanAction struct {
+	Action    string            `json:"action"`
+	Space     *resource.Space   `json:"space"`
+	Timestamp time.Time         `json:"timestamp"`
+	Stage     *NotifyStage      `json:"stage,omitempty"`
+	Routes    []*resource.Route `json:"routes,omitempty"`
+	Members   spaceMembers      `json:"members"`
+}
+
+func (a PlanAction) details() SpaceDetails {
+	return SpaceDetails{
+		Timestamp: a.Timestamp,
+		Space:     a.Space,
+		Stage:     a.Stage,
+	}
+}
+
+// buildPlan lists the spaces to notify, purge or clean up in each org, along
+// with the users to email and the roles to restore; orgs are listed in
+// parallel, and failures are recorded on the org rather than stopping the run
+func buildPlan(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	policy *Policy,
+	userGUIDs map[string]bool,
+	orgs []*resource.Organization,
+	now time.Time,
+) *Plan {
+	plan := &Plan{CreatedAt: now, Orgs: make([]PlanOrg, len(orgs))}
+	forEachParallel(opts.Concurrency, len(orgs), func(i int) {
+		plan.Orgs[i] = buildOrgPlan(ctx, cfClient, opts, policy, userGUIDs, orgs[i], now)
+	})
+	return plan
+}
+
+// buildOrgPlan lists the actions for a single org
+func buildOrgPlan(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	policy *Policy,
+	userGUIDs map[string]bool,
+	org *resource.Organization,
+	now time.Time,
+) PlanOrg {
+	ctx = withLogAttrs(ctx, "org", org.Name)
+	orgOpts, profile := policy.orgOptions(opts, org.Name)
+	planOrg := PlanOrg{Org: org, Actions: []PlanAction{}}
+	if profile != nil {
+		slog.InfoContext(ctx, "using policy profile", "profile", profile.Name)
+		planOrg.Profile = profile.Name
+	}
+
+	timeStartsAt, err := parseTimeStartsAt(orgOpts.TimeStartsAt)
+	if err != nil {
+		planOrg.Errors = append(planOrg.Errors, fmt.Sprintf("error parsing time starts at for org %s: %s", org.Name, err))
+		return planOrg
+	}
+
+	slog.InfoContext(ctx, "getting org resources")
+	resources, err := listOrgResources(ctx, cfClient, org, orgOpts, now)
+	if err != nil {
+		planOrg.Errors = append(planOrg.Errors, fmt.Sprintf("error listing org resources for org %s: %s", org.Name, err))
+		return planOrg
+	}
+	planOrg.SpaceCount = len(resources.Spaces)
+
+	toNotify, toPurge, err := listPurgeSpaces(ctx, org, resources, orgOpts, now, timeStartsAt)
+	if err != nil {
+		planOrg.Errors = append(planOrg.Errors, fmt.Sprintf("error listing spaces to purge for org %s: %s", org.Name, err))
+		return planOrg
+	}
+	orphaned := listOrphanedRoutes(ctx, org, resources, orgOpts, now, toPurge)
+
+	addAction := func(action string, details SpaceDetails, routes []*resource.Route) {
+		members, err := listSpaceMembers(withLogAttrs(ctx, "space_guid", details.Space.GUID), cfClient, userGUIDs, details.Space)
+		if err != nil {
+			planOrg.Errors = append(planOrg.Errors, fmt.Sprintf("error planning %s of space %s in org %s: %s", action, details.Space.Name, org.Name, err))
+			return
+		}
+		planOrg.Actions = append(planOrg.Actions, PlanAction{
+			Action:    action,
+			Space:     details.Space,
+			Timestamp: details.Timestamp,
+			Stage:     details.Stage,
+			Routes:    routes,
+			Members:   members,
+		})
+	}
+
+	for _, details := range toNotify {
+		addAction(actionNotify, details, nil)
+	}
+	for _, details := range toPurge {
+		addAction(actionPurge, details, nil)
+	}
+	for _, routes := range orphaned {
+		addAction(actionDeleteRoutes, SpaceDetails{Space: routes.Space}, routes.Routes)
+	}
+
+	return planOrg
+}
+
+// listErrors lists the errors recorded while building a plan, in org order
+func (p *Plan) listErrors() []string {
+	var errs []string
+	for _, org := range p.Orgs {
+		errs = append(errs, org.Errors...)
+	}
+	return errs
+}
+
+// writePlan saves a plan as JSON, encrypted if a cipher is configured
+func writePlan(filename string, plan *Plan, cipher *artifactCipher) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding plan: %w", err)
+	}
+	data, err = cipher.encrypt(data)
+	if err != nil {
+		return fmt.Errorf("error encrypting plan: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		return fmt.Errorf("error writing plan file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// readPlan loads a plan written by writePlan
+func readPlan(filename string, cipher *artifactCipher) (*Plan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan file %s: %w", filename, err)
+	}
+	data, err = cipher.decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting plan file %s: %w", filename, err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("error decoding plan file %s: %w", filename, err)
+	}
+	return &plan, nil
+}
+
+// withoutSpaces returns a copy of a plan without actions for the given spaces
+func withoutSpaces(plan *Plan, spaceGUIDs map[string]bool) *Plan {
+	filtered := &Plan{CreatedAt: plan.CreatedAt}
+	for _, planOrg := range plan.Orgs {
+		filteredOrg := planOrg
+		filteredOrg.Actions = []PlanAction{}
+		for _, action := range planOrg.Actions {
+			if !spaceGUIDs[action.Space.GUID] {
+				filteredOrg.Actions = append(filteredOrg.Actions, action)
+			}
+		}
+		filtered.Orgs = append(filtered.Orgs, filteredOrg)
+	}
+	return filtered
+}
+
+// filterPlan returns a copy of a plan with only the given actions, for
+// running a single phase
+func filterPlan(plan *Plan, actions ...string) *Plan {
+	keep := map[string]bool{}
+	for _, action := range actions {
+		keep[action] = true
+	}
+
+	filtered := &Plan{CreatedAt: plan.CreatedAt}
+	for _, planOrg := range plan.Orgs {
+		filteredOrg := planOrg
+		filteredOrg.Actions = []PlanAction{}
+		for _, action := range planOrg.Actions {
+			if keep[action.Action] {
+				filteredOrg.Actions = append(filteredOrg.Actions, action)
+			}
+		}
+		filtered.Orgs = append(filtered.Orgs, filteredOrg)
+	}
+	return filtered
+}
+
+func planActionKey(org *resource.Organization, action PlanAction) string {
+	return fmt.Sprintf("%s/%s/%s", org.GUID, action.Space.Name, action.Action)
+}
+
+// checkPlanDrift compares a saved plan against a plan built from live state
+// and describes each planned action that no longer matches
+func checkPlanDrift(planned, live *Plan) []string {
+	liveActions := map[string]PlanAction{}
+	for _, org := range live.Orgs {
+		for _, action := range org.Actions {
+			liveActions[planActionKey(org.Org, action)] = action
+		}
+	}
+
+	var drift []string
+	for _, org := range planned.Orgs {
+		for _, action := range org.Actions {
+			prefix := fmt.Sprintf("%s of space %s in org %s", action.Action, action.Space.Name, org.Org.Name)
+			current, ok := liveActions[planActionKey(org.Org, action)]
+			switch {
+			case !ok:
+				drift = append(drift, prefix+": no longer planned")
+			case current.Space.GUID != action.Space.GUID:
+				drift = append(drift, fmt.Sprintf("%s: space GUID changed from %s to %s", prefix, action.Space.GUID, current.Space.GUID))
+			case !current.Timestamp.Equal(action.Timestamp):
+				drift = append(drift, fmt.Sprintf("%s: first resource changed from %s to %s", prefix, action.Timestamp, current.Timestamp))
+			case !reflect.DeepEqual(current.Stage, action.Stage):
+				drift = append(drift, prefix+": notify stage changed")
+			case !current.Members.equal(action.Members):
+				drift = append(drift, prefix+": recipients or roles changed")
+			case !reflect.DeepEqual(listRouteGUIDs(current.Routes), listRouteGUIDs(action.Routes)):
+				drift = append(drift, prefix+": routes changed")
+			}
+		}
+	}
+	return drift
+}
+
+func listRouteGUIDs(routes []*resource.Route) []string {
+	var guids []string
+	for _, route := range routes {
+		guids = append(guids, route.GUID)
+	}
+	return guids
+}
+
+// actionResult records the outcome of a planned action
+type actionResult struct {
+	Org    string
+	Space  string
+	Action string
+	Err    error
+}
+
+// applyPlan carries out the actions in a plan in parallel, returning a result
+// for each action in plan order; cancelling ctx stops the run between spaces
+func applyPlan(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	policy *Policy,
+	plan *Plan,
+	ledger *notifyLedger,
+	snapshots *snapshotStore,
+	exports *exportStore,
+	mailSender mailer,
+) []actionResult {
+	type orgAction struct {
+		org    *resource.Organization
+		action PlanAction
+	}
+	var actions []orgAction
+	for _, planOrg := range plan.Orgs {
+		for _, action := range planOrg.Actions {
+			actions = append(actions, orgAction{org: planOrg.Org, action: action})
+		}
+	}
+
+	results := make([]actionResult, len(actions))
+	forEachParallel(opts.Concurrency, len(actions), func(i int) {
+		org, action := actions[i].org, actions[i].action
+		results[i] = actionResult{
+			Org:    org.Name,
+			Space:  action.Space.Name,
+			Action: action.Action,
+		}
+		// Once the run is stopped, skip actions that haven't started, but
+		// let ones in progress finish so no space is left half purged
+		if ctx.Err() != nil {
+			results[i].Err = ErrRunStopped
+			return
+		}
+		orgOpts, _ := policy.orgOptions(opts, org.Name)
+		actionCtx := withLogAttrs(ctx, "org", org.Name, "space_guid", action.Space.GUID, "phase", action.Action)
+		results[i].Err = applyAction(context.WithoutCancel(actionCtx), cfClient, orgOpts, org, action, ledger, snapshots, exports, mailSender)
+	})
+	return results
+}
+
+// applyAction carries out a single planned action
+func applyAction(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	org *resource.Organization,
+	action PlanAction,
+	ledger *notifyLedger,
+	snapshots *snapshotStore,
+	exports *exportStore,
+	mailSender mailer,
+) error {
+	switch action.Action {
+	case actionNotify:
+		err := notifySpaceUsers(ctx, opts, org, action.details(), action.Members, mailSender, ledger)
+		if err != nil {
+			return fmt.Errorf("error notifying space %s in org %s: %w", action.Space.Name, org.Name, err)
+		}
+	case actionPurge:
+		err := purgeAndRecreateSpace(ctx, cfClient, opts, org, action.details(), action.Members, snapshots, exports, mailSender)
+		if err != nil {
+			return err
+		}
+		if !opts.DryRun {
+			if err := ledger.forget(action.Space.GUID); err != nil {
+				slog.ErrorContext(ctx, "error removing space from ledger", "space", action.Space.Name, "error", err)
+			}
+		}
+	case actionDeleteRoutes:
+		orphaned := OrphanedRoutes{Space: action.Space, Routes: action.Routes}
+		return deleteOrphanedRoutes(ctx, cfClient, opts, org, orphaned, action.Members, mailSender)
+	default:
+		return fmt.Errorf("unknown action %q for space %s in org %s", action.Action, action.Space.Name, org.Name)
+	}
+	return nil
+}
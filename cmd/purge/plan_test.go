@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func newTestPlan(modify func(action *PlanAction)) *Plan {
+	action := PlanAction{
+		Action:    actionPurge,
+		Space:     &resource.Space{GUID: "space-guid", Name: "space"},
+		Timestamp: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Members: spaceMembers{
+			Recipients: []string{"foo@bar.gov"},
+			Developers: []spaceUser{{GUID: "user-1", Username: "foo@bar.gov"}},
+		},
+	}
+	if modify != nil {
+		modify(&action)
+	}
+	return &Plan{
+		Orgs: []PlanOrg{
+			{
+				Org:     &resource.Organization{GUID: "org-guid", Name: "org"},
+				Actions: []PlanAction{action},
+			},
+		},
+	}
+}
+
+func TestCheckPlanDrift(t *testing.T) {
+	testCases := map[string]struct {
+		live          *Plan
+		expectedDrift []string
+	}{
+		"no drift": {
+			live: newTestPlan(nil),
+		},
+		"space no longer planned": {
+			live: &Plan{},
+			expectedDrift: []string{
+				"purge of space space in org org: no longer planned",
+			},
+		},
+		"space GUID changed": {
+			live: newTestPlan(func(action *PlanAction) {
+				action.Space = &resource.Space{GUID: "new-space-guid", Name: "space"}
+			}),
+			expectedDrift: []string{
+				"purge of space space in org org: space GUID changed from space-guid to new-space-guid",
+			},
+		},
+		"new resources reset the clock": {
+			live: newTestPlan(func(action *PlanAction) {
+				action.Timestamp = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+			}),
+			expectedDrift: []string{
+				"purge of space space in org org: first resource changed from 2024-05-01 00:00:00 +0000 UTC to 2024-06-01 00:00:00 +0000 UTC",
+			},
+		},
+		"roles changed": {
+			live: newTestPlan(func(action *PlanAction) {
+				action.Members.Developers = nil
+			}),
+			expectedDrift: []string{
+				"purge of space space in org org: recipients or roles changed",
+			},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			drift := checkPlanDrift(newTestPlan(nil), test.live)
+			if diff := cmp.Diff(test.expectedDrift, drift); diff != "" {
+				t.Errorf("drift mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteAndReadPlan(t *testing.T) {
+	testCases := map[string]struct {
+		plan *Plan
+	}{
+		"notify stage": {
+			plan: newTestPlan(func(action *PlanAction) {
+				action.Action = actionNotify
+				action.Stage = &NotifyStage{Name: "final", DaysBeforePurge: 1, Template: finalNotifyTemplate}
+			}),
+		},
+		"space with no developers or managers": {
+			plan: newTestPlan(func(action *PlanAction) {
+				action.Members = spaceMembers{
+					Recipients: []string{},
+					Developers: []spaceUser{},
+					Managers:   []spaceUser{},
+				}
+			}),
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "plan.json")
+			if err := writePlan(filename, test.plan, nil); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			saved, err := readPlan(filename, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if drift := checkPlanDrift(saved, test.plan); len(drift) > 0 {
+				t.Errorf("expected saved plan to match, got drift: %v", drift)
+			}
+		})
+	}
+}
+
+func TestWithoutSpaces(t *testing.T) {
+	plan := newTestPlan(nil)
+	plan.Orgs[0].Actions = append(plan.Orgs[0].Actions, PlanAction{
+		Action: actionNotify,
+		Space:  &resource.Space{GUID: "other-space-guid", Name: "other-space"},
+	})
+
+	filtered := withoutSpaces(plan, map[string]bool{"space-guid": true})
+	if len(filtered.Orgs[0].Actions) != 1 || filtered.Orgs[0].Actions[0].Space.GUID != "other-space-guid" {
+		t.Errorf("expected only other-space to be left, got %+v", filtered.Orgs[0].Actions)
+	}
+	if len(plan.Orgs[0].Actions) != 2 {
+		t.Errorf("expected original plan to be unchanged")
+	}
+}
+
+func TestFilterPlan(t *testing.T) {
+	plan := newTestPlan(nil)
+	plan.Orgs[0].Actions = append(plan.Orgs[0].Actions, PlanAction{
+		Action: actionNotify,
+		Space:  &resource.Space{GUID: "other-space-guid", Name: "other-space"},
+	})
+
+	filtered := filterPlan(plan, actionNotify)
+	if len(filtered.Orgs) != 1 || len(filtered.Orgs[0].Actions) != 1 {
+		t.Fatalf("expected a single notify action, got %+v", filtered.Orgs)
+	}
+	if action := filtered.Orgs[0].Actions[0]; action.Action != actionNotify {
+		t.Errorf("expected notify action, got %s", action.Action)
+	}
+	if len(plan.Orgs[0].Actions) != 2 {
+		t.Error("expected original plan to be unchanged")
+	}
+}
+
+func TestApplyPlanStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := applyPlan(ctx, &cfResourceClient{}, Options{Concurrency: 1}, nil, newTestPlan(nil), nil, nil, nil, &mockMailSender{})
+	expected := []actionResult{{Org: "org", Space: "space", Action: actionPurge, Err: ErrRunStopped}}
+	if diff := cmp.Diff(expected, results, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
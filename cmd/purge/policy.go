@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyProfile overrides thresholds, quota name and clock start for the orgs
+// whose names match one of its patterns
+type PolicyProfile struct {
+	Name             string        `yaml:"name"`
+	Orgs             []string      `yaml:"orgs"`
+	NotifyDays       *int          `yaml:"notify_days"`
+	PurgeDays        *int          `yaml:"purge_days"`
+	SandboxQuotaName string        `yaml:"sandbox_quota_name"`
+	TimeStartsAt     string        `yaml:"time_starts_at"`
+	NotifyStages     []NotifyStage `yaml:"notify_stages"`
+}
+
+// Policy describes default reminder stages and per-org profiles; the first
+// matching profile wins
+type Policy struct {
+	NotifyStages []NotifyStage   `yaml:"notify_stages"`
+	Profiles     []PolicyProfile `yaml:"profiles"`
+}
+
+// loadPolicy reads and validates a YAML or JSON policy file against the
+// options it overrides
+func loadPolicy(filename string, opts Options) (*Policy, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy Policy
+	if err := yaml.Unmarshal(contents, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing policy file %s: %w", filename, err)
+	}
+	if err := policy.validate(opts); err != nil {
+		return nil, fmt.Errorf("error validating policy file %s: %w", filename, err)
+	}
+	return &policy, nil
+}
+
+func (p *Policy) validate(opts Options) error {
+	if err := validateNotifyStages(p.NotifyStages); err != nil {
+		return err
+	}
+	if len(p.NotifyStages) > 0 {
+		opts.NotifyStages = p.NotifyStages
+		if err := validatePurgeThresholds(opts); err != nil {
+			return err
+		}
+	}
+	for i, profile := range p.Profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("profile %d has no name", i)
+		}
+		if len(profile.Orgs) == 0 {
+			return fmt.Errorf("profile %s has no orgs", profile.Name)
+		}
+		for _, pattern := range profile.Orgs {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("profile %s has invalid org pattern %q: %w", profile.Name, pattern, err)
+			}
+		}
+		if _, err := parseTimeStartsAt(profile.TimeStartsAt); err != nil {
+			return fmt.Errorf("profile %s has invalid time_starts_at: %w", profile.Name, err)
+		}
+		if err := validateNotifyStages(profile.NotifyStages); err != nil {
+			return fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+		if err := validatePurgeThresholds(profile.apply(opts)); err != nil {
+			return fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+	}
+	return nil
+}
+
+// validatePurgeThresholds checks that every reminder comes before the purge,
+// so no org's spaces are purged without warning
+func validatePurgeThresholds(opts Options) error {
+	if opts.PurgeDays < 1 {
+		return fmt.Errorf("purge_days must be at least 1, got %d", opts.PurgeDays)
+	}
+	if len(opts.NotifyStages) == 0 && len(opts.NotifyStageDays) == 0 {
+		if opts.NotifyDays >= opts.PurgeDays {
+			return fmt.Errorf("notify_days (%d) must be less than purge_days (%d)", opts.NotifyDays, opts.PurgeDays)
+		}
+		return nil
+	}
+	for _, stage := range listNotifyStages(opts) {
+		if stage.DaysBeforePurge >= opts.PurgeDays {
+			return fmt.Errorf("stage %s days_before_purge (%d) must be less than purge_days (%d)", stage.Name, stage.DaysBeforePurge, opts.PurgeDays)
+		}
+	}
+	return nil
+}
+
+// matchProfile returns the first profile matching an org name, or nil
+func (p *Policy) matchProfile(orgName string) *PolicyProfile {
+	if p == nil {
+		return nil
+	}
+	for i, profile := range p.Profiles {
+		for _, pattern := range profile.Orgs {
+			if matched, _ := path.Match(pattern, orgName); matched {
+				return &p.Profiles[i]
+			}
+		}
+	}
+	return nil
+}
+
+// orgOptions returns the options for an org with the policy defaults and any
+// matching profile applied
+func (p *Policy) orgOptions(opts Options, orgName string) (Options, *PolicyProfile) {
+	if p != nil && len(p.NotifyStages) > 0 {
+		opts.NotifyStages = p.NotifyStages
+	}
+	profile := p.matchProfile(orgName)
+	if profile == nil {
+		return opts, nil
+	}
+	return profile.apply(opts), profile
+}
+
+// apply returns the options with the profile's overrides
+func (profile *PolicyProfile) apply(opts Options) Options {
+	if profile.NotifyDays != nil {
+		opts.NotifyDays = *profile.NotifyDays
+	}
+	if profile.PurgeDays != nil {
+		opts.PurgeDays = *profile.PurgeDays
+	}
+	if profile.SandboxQuotaName != "" {
+		opts.SandboxQuotaName = profile.SandboxQuotaName
+	}
+	if profile.TimeStartsAt != "" {
+		opts.TimeStartsAt = profile.TimeStartsAt
+	}
+	if len(profile.NotifyStages) > 0 {
+		opts.NotifyStages = profile.NotifyStages
+	}
+	return opts
+}
+
+// hasStages reports whether the policy sets reminder stages for any org
+func (p *Policy) hasStages() bool {
+	if p == nil {
+		return false
+	}
+	if len(p.NotifyStages) > 0 {
+		return true
+	}
+	for _, profile := range p.Profiles {
+		if len(profile.NotifyStages) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeStartsAt parses an optional clock start time
+func parseTimeStartsAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
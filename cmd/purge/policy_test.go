@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	testCases := map[string]struct {
+		contents    string
+		expectedErr string
+	}{
+		"valid YAML policy": {
+			contents: `
+profiles:
+- name: pilot
+  orgs: ["sandbox-pilot-*"]
+  notify_days: 50
+  purge_days: 60
+  time_starts_at: 2024-01-01T00:00:00Z
+`,
+		},
+		"valid JSON policy": {
+			contents: `{"profiles": [{"name": "agency", "orgs": ["sandbox-agency"], "sandbox_quota_name": "agency-quota"}]}`,
+		},
+		"profile without orgs": {
+			contents: `
+profiles:
+- name: pilot
+`,
+			expectedErr: "profile pilot has no orgs",
+		},
+		"invalid org pattern": {
+			contents: `
+profiles:
+- name: pilot
+  orgs: ["sandbox-["]
+`,
+			expectedErr: `profile pilot has invalid org pattern "sandbox-[": syntax error in pattern`,
+		},
+		"invalid time starts at": {
+			contents: `
+profiles:
+- name: pilot
+  orgs: ["sandbox-pilot"]
+  time_starts_at: yesterday
+`,
+			expectedErr: `profile pilot has invalid time_starts_at: parsing time "yesterday" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "yesterday" as "2006"`,
+		},
+		"profile purges before the default reminder": {
+			contents: `
+profiles:
+- name: pilot
+  orgs: ["sandbox-pilot"]
+  purge_days: 10
+`,
+			expectedErr: "profile pilot: notify_days (25) must be less than purge_days (10)",
+		},
+		"profile purges before a default stage": {
+			contents: `
+notify_stages:
+- name: first
+  days_before_purge: 14
+profiles:
+- name: pilot
+  orgs: ["sandbox-pilot"]
+  purge_days: 10
+`,
+			expectedErr: "profile pilot: stage first days_before_purge (14) must be less than purge_days (10)",
+		},
+		"default stage after the purge": {
+			contents: `
+notify_stages:
+- name: first
+  days_before_purge: 30
+`,
+			expectedErr: "stage first days_before_purge (30) must be less than purge_days (30)",
+		},
+		"profile lowers both thresholds": {
+			contents: `
+profiles:
+- name: pilot
+  orgs: ["sandbox-pilot"]
+  notify_days: 5
+  purge_days: 10
+`,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "policy.yml")
+			if err := os.WriteFile(filename, []byte(test.contents), 0644); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			_, err := loadPolicy(filename, Options{NotifyDays: 25, PurgeDays: 30})
+			if test.expectedErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if test.expectedErr != "" {
+				expectedErr := "error validating policy file " + filename + ": " + test.expectedErr
+				if err == nil || err.Error() != expectedErr {
+					t.Fatalf("expected error: %s, got: %s", expectedErr, err)
+				}
+			}
+		})
+	}
+}
+
+func TestOrgOptions(t *testing.T) {
+	notifyDays := 50
+	purgeDays := 60
+	policy := &Policy{
+		Profiles: []PolicyProfile{
+			{
+				Name:       "pilot",
+				Orgs:       []string{"sandbox-pilot-*"},
+				NotifyDays: &notifyDays,
+				PurgeDays:  &purgeDays,
+			},
+			{
+				Name:             "agency",
+				Orgs:             []string{"sandbox-agency", "sandbox-pilot-agency"},
+				SandboxQuotaName: "agency-quota",
+				TimeStartsAt:     "2024-01-01T00:00:00Z",
+			},
+		},
+	}
+	defaults := Options{
+		NotifyDays:       25,
+		PurgeDays:        30,
+		SandboxQuotaName: "sandbox",
+	}
+
+	testCases := map[string]struct {
+		policy          *Policy
+		orgName         string
+		expectedOptions Options
+		expectedProfile string
+	}{
+		"no policy keeps defaults": {
+			orgName:         "sandbox-pilot-one",
+			expectedOptions: defaults,
+		},
+		"unmatched org keeps defaults": {
+			policy:          policy,
+			orgName:         "sandbox-other",
+			expectedOptions: defaults,
+		},
+		"applies thresholds from matching profile": {
+			policy:  policy,
+			orgName: "sandbox-pilot-one",
+			expectedOptions: Options{
+				NotifyDays:       50,
+				PurgeDays:        60,
+				SandboxQuotaName: "sandbox",
+			},
+			expectedProfile: "pilot",
+		},
+		"first matching profile wins": {
+			policy:  policy,
+			orgName: "sandbox-pilot-agency",
+			expectedOptions: Options{
+				NotifyDays:       50,
+				PurgeDays:        60,
+				SandboxQuotaName: "sandbox",
+			},
+			expectedProfile: "pilot",
+		},
+		"applies quota and time starts at from matching profile": {
+			policy:  policy,
+			orgName: "sandbox-agency",
+			expectedOptions: Options{
+				NotifyDays:       25,
+				PurgeDays:        30,
+				SandboxQuotaName: "agency-quota",
+				TimeStartsAt:     "2024-01-01T00:00:00Z",
+			},
+			expectedProfile: "agency",
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			opts, profile := test.policy.orgOptions(defaults, test.orgName)
+			if diff := cmp.Diff(test.expectedOptions, opts); diff != "" {
+				t.Errorf("OrgOptions() mismatch (-want +got):\n%s", diff)
+			}
+			var profileName string
+			if profile != nil {
+				profileName = profile.Name
+			}
+			if profileName != test.expectedProfile {
+				t.Errorf("expected profile: %s, got: %s", test.expectedProfile, profileName)
+			}
+		})
+	}
+}
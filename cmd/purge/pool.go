@@ -0,0 +1,28 @@
+package main
+
+import "sync"
+
+// forEachParallel calls fn for each index from 0 to n-1, running at most
+// concurrency calls at once; callers store results by index so output order
+// doesn't depend on scheduling
+func forEachParallel(concurrency int, n int, fn func(i int)) {
+	workers := min(max(concurrency, 1), n)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
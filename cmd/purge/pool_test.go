@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestForEachParallel(t *testing.T) {
+	testCases := map[string]struct {
+		concurrency int
+		n           int
+	}{
+		"serial": {
+			concurrency: 1,
+			n:           5,
+		},
+		"more workers than items": {
+			concurrency: 10,
+			n:           3,
+		},
+		"bounded": {
+			concurrency: 3,
+			n:           50,
+		},
+		"no items": {
+			concurrency: 3,
+		},
+		"zero concurrency runs serially": {
+			n: 5,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			results := make([]int, test.n)
+
+			forEachParallel(test.concurrency, test.n, func(i int) {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				mu.Unlock()
+
+				results[i] = i * 2
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+			})
+
+			for i, result := range results {
+				if result != i*2 {
+					t.Errorf("expected result %d for index %d, got %d", i*2, i, result)
+				}
+			}
+			if maxRunning > max(test.concurrency, 1) {
+				t.Errorf("expected at most %d concurrent calls, got %d", max(test.concurrency, 1), maxRunning)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+// smtpChecker is implemented by mailers that can check their connection
+// without sending mail
+type smtpChecker interface {
+	checkConnection(opts SMTPOptions) error
+}
+
+// preflight checks that the sandbox quota exists in each org and that the
+// mail server accepts our credentials, without changing anything
+func preflight(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	policy *Policy,
+	orgs []*resource.Organization,
+	mailSender mailer,
+) error {
+	var errs []error
+
+	if len(orgs) == 0 {
+		errs = append(errs, fmt.Errorf("no orgs found matching %s", describeOrgSelection(opts)))
+	}
+
+	for _, org := range orgs {
+		orgOpts, _ := policy.orgOptions(opts, org.Name)
+		spaceQuotaListOptions := client.NewSpaceQuotaListOptions()
+		spaceQuotaListOptions.OrganizationGUIDs.EqualTo(org.GUID)
+		spaceQuotaListOptions.Names.EqualTo(orgOpts.SandboxQuotaName)
+		if _, err := cfClient.SpaceQuotas.Single(ctx, spaceQuotaListOptions); err != nil {
+			errs = append(errs, fmt.Errorf("error finding quota %s in org %s: %w", orgOpts.SandboxQuotaName, org.Name, err))
+			continue
+		}
+		slog.InfoContext(ctx, "found sandbox quota", "org", org.Name, "quota", orgOpts.SandboxQuotaName)
+	}
+
+	if checker, ok := mailSender.(smtpChecker); ok {
+		if err := checker.checkConnection(opts.SMTPOptions); err != nil {
+			errs = append(errs, fmt.Errorf("error connecting to SMTP server %s: %w", opts.SMTPHost, err))
+		} else {
+			slog.InfoContext(ctx, "connected to SMTP server", "host", opts.SMTPHost)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -5,7 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/cloudfoundry-community/go-cfclient/v3/client"
@@ -14,82 +14,136 @@ import (
 
 var (
 	ErrNoSpaceDeleteJobGUID = errors.New("cannot verify space deletion: no job GUID")
+	// ErrSpaceDeletePending means a delete job outlasted DELETE_TIMEOUT with
+	// DELETE_ASYNC set; a later run recreates the space once it completes
+	ErrSpaceDeletePending = errors.New("space delete job is still running")
 )
 
 func purgeAndRecreateSpace(
 	ctx context.Context,
 	cfClient *cfResourceClient,
 	opts Options,
-	userGUIDs map[string]bool,
 	org *resource.Organization,
 	details SpaceDetails,
+	members spaceMembers,
+	snapshots *snapshotStore,
+	exports *exportStore,
 	mailSender mailer,
 ) error {
-	roleListOpts := client.NewRoleListOptions()
-	roleListOpts.SpaceGUIDs.Values = []string{details.Space.GUID}
-	spaceRoles, spaceUsers, err := cfClient.Roles.ListIncludeUsersAll(ctx, roleListOpts)
-	if err != nil {
-		return fmt.Errorf("error listing roles with users on space %s: %w", details.Space.Name, err)
-	}
+	recipients, developers, managers := members.Recipients, members.Developers, members.Managers
+	slog.InfoContext(ctx, "purging space", "space", details.Space.Name, "recipients", recipients)
 
-	recipients, err := listRecipients(userGUIDs, spaceUsers)
-	if err != nil {
-		return fmt.Errorf("error listing recipients on space %s: %w", details.Space.Name, err)
+	if opts.DryRun {
+		return nil
 	}
 
-	developers, managers := listSpaceDevsAndManagers(userGUIDs, spaceRoles, spaceUsers)
-	log.Printf("Purging space %s; recipients: %+v", details.Space.Name, recipients)
+	var exportName string
+	if exports != nil {
+		export, err := buildSpaceExport(ctx, cfClient, details.Space)
+		if err != nil {
+			return &purgeStageError{stage: purgeStageExport, err: fmt.Errorf("error exporting space %s in org %s: %w", details.Space.Name, org.Name, err)}
+		}
+		exportName, err = exports.write(details.Space, time.Now(), export)
+		if err != nil {
+			return &purgeStageError{stage: purgeStageExport, err: fmt.Errorf("error saving export of space %s in org %s: %w", details.Space.Name, org.Name, err)}
+		}
+		slog.InfoContext(ctx, "exported space", "space", details.Space.Name, "export", exportName)
+	}
 
-	if opts.DryRun {
-		return nil
+	if err := sendPurgeEmail(ctx, opts, org, details, recipients, exportName, mailSender); err != nil {
+		return &purgeStageError{stage: purgeStageEmail, err: fmt.Errorf("error sending purge notification email for space %s in org %s: %w", details.Space.Name, org.Name, err)}
 	}
 
-	if err := sendPurgeEmail(opts, org, details, recipients, mailSender); err != nil {
-		return fmt.Errorf("error sending purge notification email for space %s in org %s: %w", details.Space.Name, org.Name, err)
+	snapshot := &purgeSnapshot{
+		CreatedAt:  time.Now(),
+		Org:        org,
+		Space:      details.Space,
+		Developers: developers,
+		Managers:   managers,
+	}
+	if err := snapshots.save(snapshot); err != nil {
+		return &purgeStageError{stage: purgeStageSnapshot, err: fmt.Errorf("error saving snapshot of space %s in org %s: %w", details.Space.Name, org.Name, err)}
 	}
 
-	log.Printf("purging space %s", details.Space.Name)
+	slog.InfoContext(ctx, "deleting space", "space", details.Space.Name)
 	deleteJobGUID, err := purgeSpace(ctx, cfClient, details.Space)
 	if err != nil {
-		return fmt.Errorf("error purging space %s in org %s: %w", details.Space.Name, org.Name, err)
+		// The space was never deleted, so there's nothing to recover
+		if err := snapshots.remove(details.Space.GUID); err != nil {
+			slog.ErrorContext(ctx, "error removing snapshot", "space", details.Space.Name, "error", err)
+		}
+		return &purgeStageError{stage: purgeStageDelete, err: fmt.Errorf("error purging space %s in org %s: %w", details.Space.Name, org.Name, err)}
 	}
 
-	err = waitForSpaceDeletion(ctx, cfClient, deleteJobGUID)
+	snapshot.DeleteJobGUID = deleteJobGUID
+	if err := snapshots.save(snapshot); err != nil {
+		slog.ErrorContext(ctx, "error updating snapshot", "space", details.Space.Name, "error", err)
+	}
+
+	err = waitForSpaceDeletion(ctx, cfClient, opts, details.Space.GUID, deleteJobGUID)
+	if opts.DeleteAsync && errors.Is(err, client.AsyncProcessTimeoutError) {
+		slog.WarnContext(ctx, "delete job is still running; the next run will recreate the space once it completes", "space", details.Space.Name, "job_guid", deleteJobGUID)
+		return ErrSpaceDeletePending
+	}
 	if err != nil {
-		return fmt.Errorf("error waiting for delete job %s to be complete: %w", deleteJobGUID, err)
+		return &purgeStageError{stage: purgeStageWait, err: fmt.Errorf("error waiting for delete job %s to be complete: %w", deleteJobGUID, err)}
 	}
 
-	log.Printf("recreating space %s", details.Space.Name)
+	slog.InfoContext(ctx, "recreating space", "space", details.Space.Name)
 	space, err := recreateSpace(ctx, cfClient, opts, org, details)
 	if err != nil {
-		return fmt.Errorf("error recreating space %s in org %s: %w", details.Space.Name, org.Name, err)
+		return &purgeStageError{stage: purgeStageRecreate, err: fmt.Errorf("error recreating space %s in org %s: %w", details.Space.Name, org.Name, err)}
+	}
+
+	snapshot.RecreatedSpaceGUID = space.GUID
+	if err := snapshots.save(snapshot); err != nil {
+		slog.ErrorContext(ctx, "error updating snapshot", "space", details.Space.Name, "error", err)
 	}
 
 	if len(developers) > 0 || len(managers) > 0 {
-		log.Printf("recreating space roles for space %s", space.Name)
+		slog.InfoContext(ctx, "recreating space roles", "space", space.Name, "new_space_guid", space.GUID)
 		if err := recreateSpaceDevsAndManagers(ctx, cfClient, space.GUID, developers, managers); err != nil {
-			return fmt.Errorf("error recreating space developers/managers for space %s in org %s: %w", details.Space.Name, org.Name, err)
+			return &purgeStageError{stage: purgeStageRoles, err: fmt.Errorf("error recreating space developers/managers for space %s in org %s: %w", details.Space.Name, org.Name, err)}
 		}
 	}
 
+	if err := snapshots.remove(details.Space.GUID); err != nil {
+		slog.ErrorContext(ctx, "error removing snapshot", "space", details.Space.Name, "error", err)
+	}
+
 	return nil
 }
 
-func waitForSpaceDeletion(ctx context.Context, cfClient *cfResourceClient, deleteJobGUID string) error {
+// waitForSpaceDeletion polls the delete job until it completes. A retried
+// delete that finds the space already gone returns no job GUID, so without
+// one the space itself must be gone.
+func waitForSpaceDeletion(ctx context.Context, cfClient *cfResourceClient, opts Options, spaceGUID string, deleteJobGUID string) error {
 	if deleteJobGUID == "" {
-		return ErrNoSpaceDeleteJobGUID
+		listOpts := client.NewSpaceListOptions()
+		listOpts.GUIDs.EqualTo(spaceGUID)
+		spaces, err := cfClient.Spaces.ListAll(ctx, listOpts)
+		if err != nil {
+			return fmt.Errorf("error checking for space %s: %w", spaceGUID, err)
+		}
+		if len(spaces) > 0 {
+			return ErrNoSpaceDeleteJobGUID
+		}
+		return nil
 	}
 
 	pollingOptions := client.NewPollingOptions()
-	pollingOptions.Timeout = 1 * time.Minute
+	pollingOptions.Timeout = opts.DeleteTimeout
+	pollingOptions.CheckInterval = opts.DeletePollInterval
 	return cfClient.Jobs.PollComplete(ctx, deleteJobGUID, pollingOptions)
 }
 
 func sendPurgeEmail(
+	ctx context.Context,
 	opts Options,
 	org *resource.Organization,
 	details SpaceDetails,
 	recipients []string,
+	exportName string,
 	mailSender mailer,
 ) error {
 	purgeTemplate, err := template.ParseFiles("../../templates/base.html", "../../templates/purge.tmpl")
@@ -98,16 +152,18 @@ func sendPurgeEmail(
 	}
 
 	data := map[string]interface{}{
-		"org":   org,
-		"space": details.Space,
-		"days":  opts.PurgeDays,
+		"org":    org,
+		"space":  details.Space,
+		"days":   opts.PurgeDays,
+		"export": exportName,
 	}
 	body, err := renderTemplate(purgeTemplate, data)
 	if err != nil {
 		return fmt.Errorf("error rendering email: %s", err)
 	}
 
-	log.Printf("sending to %s: %s", recipients, body)
+	slog.InfoContext(ctx, "sending email", "subject", opts.PurgeMailSubject, "recipients", recipients)
+	slog.DebugContext(ctx, "email body", "body", body)
 	if err := mailSender.sendMail(opts.SMTPOptions, opts.MailSender, opts.PurgeMailSubject, body, recipients); err != nil {
 		return fmt.Errorf("error sending mail on space %s: %w", details.Space.Name, err)
 	}
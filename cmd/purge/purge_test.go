@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/cloudfoundry-community/go-cfclient/v3/client"
 	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
@@ -17,6 +19,7 @@ type mockApplications struct {
 	apps            []*resource.App
 	deleteCallCount int
 	deleteErr       error
+	envVars         map[string]*string
 }
 
 func (a *mockApplications) ListAll(ctx context.Context, opts *client.AppListOptions) ([]*resource.App, error) {
@@ -28,6 +31,10 @@ func (a *mockApplications) Delete(ctx context.Context, guid string) (string, err
 	return "", a.deleteErr
 }
 
+func (a *mockApplications) GetEnvironmentVariables(ctx context.Context, guid string) (map[string]*string, error) {
+	return a.envVars, nil
+}
+
 type spaceCreatedRole struct {
 	SpaceGUID string
 	UserGUID  string
@@ -74,6 +81,8 @@ type mockSpaces struct {
 	space                      *resource.Space
 	deleteJobGUID              string
 	deleteErr                  error
+	existingSpaces             []*resource.Space
+	createCallCount            int
 }
 
 func (s *mockSpaces) ListUsersAll(ctx context.Context, spaceGUID string, opts *client.UserListOptions) ([]*resource.User, error) {
@@ -87,10 +96,21 @@ func (s *mockSpaces) ListUsersAll(ctx context.Context, spaceGUID string, opts *c
 }
 
 func (s *mockSpaces) ListAll(ctx context.Context, opts *client.SpaceListOptions) ([]*resource.Space, error) {
-	return nil, nil
+	var spaces []*resource.Space
+	for _, space := range s.existingSpaces {
+		if opts != nil && len(opts.GUIDs.Values) > 0 && !slices.Contains(opts.GUIDs.Values, space.GUID) {
+			continue
+		}
+		if opts != nil && len(opts.Names.Values) > 0 && !slices.Contains(opts.Names.Values, space.Name) {
+			continue
+		}
+		spaces = append(spaces, space)
+	}
+	return spaces, nil
 }
 
 func (s *mockSpaces) Create(ctx context.Context, r *resource.SpaceCreate) (*resource.Space, error) {
+	s.createCallCount++
 	if !cmp.Equal(r, s.expectedSpaceCreateRequest) {
 		return nil, fmt.Errorf("expected creation params do not match: %s", cmp.Diff(r, s.expectedSpaceCreateRequest))
 	}
@@ -132,6 +152,14 @@ func (q *mockSpaceQuotas) Apply(ctx context.Context, guid string, spaceGUIDs []s
 type mockJobs struct {
 	expectedJobGUID string
 	pollErr         error
+	job             *resource.Job
+}
+
+func (j *mockJobs) Get(ctx context.Context, guid string) (*resource.Job, error) {
+	if j.expectedJobGUID != guid {
+		return nil, fmt.Errorf("expected job GUID: %s, received: %s", j.expectedJobGUID, guid)
+	}
+	return j.job, nil
 }
 
 func (j *mockJobs) PollComplete(ctx context.Context, jobGUID string, opts *client.PollingOptions) error {
@@ -170,10 +198,17 @@ func TestWaitForSpaceDeletion(t *testing.T) {
 		},
 		"no job GUID": {
 			cfClient: &cfResourceClient{
-				Jobs: &mockJobs{},
+				Jobs:   &mockJobs{},
+				Spaces: &mockSpaces{existingSpaces: []*resource.Space{{GUID: "space-1"}}},
 			},
 			expectedErr: ErrNoSpaceDeleteJobGUID,
 		},
+		"no job GUID after the space is gone": {
+			cfClient: &cfResourceClient{
+				Jobs:   &mockJobs{},
+				Spaces: &mockSpaces{},
+			},
+		},
 		"error": {
 			cfClient: &cfResourceClient{
 				Jobs: &mockJobs{
@@ -191,6 +226,8 @@ func TestWaitForSpaceDeletion(t *testing.T) {
 			err := waitForSpaceDeletion(
 				context.Background(),
 				test.cfClient,
+				Options{DeleteTimeout: time.Minute, DeletePollInterval: time.Second},
+				"space-1",
 				test.deleteJobGUID,
 			)
 
@@ -563,13 +600,25 @@ func TestPurgeAndRecreateSpace(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			err := purgeAndRecreateSpace(
+			members, err := listSpaceMembers(
 				context.Background(),
 				test.cfClient,
-				test.options,
 				test.userGUIDs,
+				test.spaceDetails.Space,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = purgeAndRecreateSpace(
+				context.Background(),
+				test.cfClient,
+				test.options,
 				test.organization,
 				test.spaceDetails,
+				members,
+				nil,
+				nil,
 				&mockMailSender{},
 			)
 
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+const (
+	resourceTypeApps               = "apps"
+	resourceTypeServiceInstances   = "service_instances"
+	resourceTypeRoutes             = "routes"
+	resourceTypeCredentialBindings = "service_credential_bindings"
+	resourceTypeTasks              = "tasks"
+	resourceTypePackages           = "packages"
+
+	// credentialBindingPageGUIDs limits the service instance GUIDs per
+	// credential binding request to keep the query string short
+	credentialBindingPageGUIDs = 50
+)
+
+var resourceTypes = []string{
+	resourceTypeApps,
+	resourceTypeServiceInstances,
+	resourceTypeRoutes,
+	resourceTypeCredentialBindings,
+	resourceTypeTasks,
+	resourceTypePackages,
+}
+
+// orgResources describes the spaces in an org and the resources that can start
+// a sandbox's clock
+type orgResources struct {
+	Spaces             []*resource.Space
+	Apps               []*resource.App
+	Instances          []*resource.ServiceInstance
+	Routes             []*resource.Route
+	CredentialBindings []*resource.ServiceCredentialBinding
+	Tasks              []*resource.Task
+	Packages           []*resource.Package
+	CreateEvents       []*resource.AuditEvent
+}
+
+// spaceResource describes a resource counted toward the age of a space;
+// AuditEvent marks resources known only from a create event, which may since
+// have been deleted
+type spaceResource struct {
+	Type       string    `json:"type"`
+	GUID       string    `json:"guid"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	AuditEvent bool      `json:"audit_event,omitempty"`
+}
+
+// validateResourceTypes checks that each resource type is known
+func validateResourceTypes(types []string) error {
+	for _, t := range types {
+		if !includesResourceType(resourceTypes, t) {
+			return fmt.Errorf("unknown resource type %s", t)
+		}
+	}
+	return nil
+}
+
+// includesResourceType reports whether a resource type counts toward the age
+// of a space; an empty list counts every type
+func includesResourceType(types []string, resourceType string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// listOptionalOrgResources fetches the routes, credential bindings, tasks,
+// packages and create audit events in an org that count toward the age of its
+// spaces
+func listOptionalOrgResources(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	org *resource.Organization,
+	opts Options,
+	now time.Time,
+	resources *orgResources,
+) (err error) {
+	types := opts.FirstResourceTypes
+
+	if opts.ClockSource == clockSourceAuditEvents {
+		// Any space with a resource created PURGE_DAYS ago is already due, so
+		// older events don't change the outcome; the extra day covers the
+		// truncation of the first resource to a day
+		since := now.Truncate(24*time.Hour).AddDate(0, 0, -opts.PurgeDays-1)
+		resources.CreateEvents, err = listCreateEvents(ctx, cfClient, org, types, since)
+		if err != nil {
+			return
+		}
+	}
+
+	// Routes are also needed to find orphaned routes
+	if includesResourceType(types, resourceTypeRoutes) || opts.OrphanedRouteDays > 0 {
+		routeListOptions := client.NewRouteListOptions()
+		routeListOptions.OrganizationGUIDs.EqualTo(org.GUID)
+		resources.Routes, err = cfClient.Routes.ListAll(ctx, routeListOptions)
+		if err != nil {
+			return
+		}
+	}
+
+	if includesResourceType(types, resourceTypeCredentialBindings) {
+		for start := 0; start < len(resources.Instances); start += credentialBindingPageGUIDs {
+			end := min(start+credentialBindingPageGUIDs, len(resources.Instances))
+			bindingListOptions := client.NewServiceCredentialBindingListOptions()
+			for _, instance := range resources.Instances[start:end] {
+				bindingListOptions.ServiceInstanceGUIDs.Values = append(bindingListOptions.ServiceInstanceGUIDs.Values, instance.GUID)
+			}
+			var bindings []*resource.ServiceCredentialBinding
+			bindings, err = cfClient.ServiceCredentialBindings.ListAll(ctx, bindingListOptions)
+			if err != nil {
+				return
+			}
+			resources.CredentialBindings = append(resources.CredentialBindings, bindings...)
+		}
+	}
+
+	if includesResourceType(types, resourceTypeTasks) {
+		taskListOptions := client.NewTaskListOptions()
+		taskListOptions.OrganizationGUIDs.EqualTo(org.GUID)
+		resources.Tasks, err = cfClient.Tasks.ListAll(ctx, taskListOptions)
+		if err != nil {
+			return
+		}
+	}
+
+	if includesResourceType(types, resourceTypePackages) {
+		for _, app := range resources.Apps {
+			var packages []*resource.Package
+			packages, err = cfClient.Packages.ListForAppAll(ctx, app.GUID, nil)
+			if err != nil {
+				return
+			}
+			resources.Packages = append(resources.Packages, packages...)
+		}
+	}
+
+	return
+}
+
+// listSpaceResources lists the resources in a space that count toward its age
+func listSpaceResources(
+	space *resource.Space,
+	resources orgResources,
+	types []string,
+) []spaceResource {
+	resources.Spaces = []*resource.Space{space}
+	spaceResources := groupResourcesBySpace(resources, types)[space.GUID]
+	if spaceResources == nil {
+		return []spaceResource{}
+	}
+	return spaceResources
+}
+
+// groupResourcesBySpace lists the resources in each space of an org that
+// count toward its age, keyed by space GUID, in one pass over the org
+func groupResourcesBySpace(resources orgResources, types []string) map[string][]spaceResource {
+	grouped := map[string][]spaceResource{}
+
+	appSpaces := map[string]string{}
+	for _, app := range resources.Apps {
+		appSpaces[app.GUID] = getRelationshipGUID(&app.Relationships.Space)
+	}
+	instanceSpaces := map[string]string{}
+	for _, instance := range resources.Instances {
+		instanceSpaces[instance.GUID] = getRelationshipGUID(instance.Relationships.Space)
+	}
+	spacesCreatedAt := map[string]time.Time{}
+	for _, space := range resources.Spaces {
+		spacesCreatedAt[space.GUID] = space.CreatedAt
+	}
+
+	add := func(resourceType string, spaceGUID string, guid string, name string, createdAt time.Time) {
+		if spaceGUID != "" && includesResourceType(types, resourceType) {
+			grouped[spaceGUID] = append(grouped[spaceGUID], spaceResource{
+				Type:      resourceType,
+				GUID:      guid,
+				Name:      name,
+				CreatedAt: createdAt,
+			})
+		}
+	}
+
+	for _, app := range resources.Apps {
+		add(resourceTypeApps, appSpaces[app.GUID], app.GUID, app.Name, app.CreatedAt)
+	}
+	for _, instance := range resources.Instances {
+		add(resourceTypeServiceInstances, instanceSpaces[instance.GUID], instance.GUID, instance.Name, instance.CreatedAt)
+	}
+	for _, route := range resources.Routes {
+		add(resourceTypeRoutes, getRelationshipGUID(&route.Relationships.Space), route.GUID, route.URL, route.CreatedAt)
+	}
+	for _, binding := range resources.CredentialBindings {
+		spaceGUID := instanceSpaces[getRelationshipGUID(binding.Relationships.ServiceInstance)]
+		if binding.Relationships.App != nil {
+			spaceGUID = appSpaces[getRelationshipGUID(binding.Relationships.App)]
+		}
+		add(resourceTypeCredentialBindings, spaceGUID, binding.GUID, binding.Name, binding.CreatedAt)
+	}
+	for _, task := range resources.Tasks {
+		add(resourceTypeTasks, appSpaces[getRelationshipGUID(&task.Relationships.App)], task.GUID, task.Name, task.CreatedAt)
+	}
+	for _, pkg := range resources.Packages {
+		add(resourceTypePackages, appSpaces[getRelationshipGUID(&pkg.Relationships.App)], pkg.GUID, pkg.GUID, pkg.CreatedAt)
+	}
+	for _, event := range resources.CreateEvents {
+		// Events for a purged space's resources belong to the deleted space
+		// GUID, but skip any recorded before this space existed to be safe
+		createdAt, ok := spacesCreatedAt[event.Space.GUID]
+		if !ok || event.CreatedAt.Before(createdAt) {
+			continue
+		}
+		if resourceType, ok := auditEventResourceTypes[event.Type]; ok && includesResourceType(types, resourceType) {
+			grouped[event.Space.GUID] = append(grouped[event.Space.GUID], spaceResource{
+				Type:       resourceType,
+				GUID:       event.Target.GUID,
+				Name:       event.Target.Name,
+				CreatedAt:  event.CreatedAt,
+				AuditEvent: true,
+			})
+		}
+	}
+
+	return grouped
+}
+
+func getRelationshipGUID(relationship *resource.ToOneRelationship) string {
+	if relationship == nil || relationship.Data == nil {
+		return ""
+	}
+	return relationship.Data.GUID
+}
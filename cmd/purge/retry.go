@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"golang.org/x/oauth2"
+)
+
+// maxRetryDelay caps the backoff between attempts
+const maxRetryDelay = 30 * time.Second
+
+// retryPolicy retries transient CF API failures with jittered exponential
+// backoff
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	// sleep waits between attempts; tests replace it to avoid waiting
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryPolicy(opts Options) retryPolicy {
+	return retryPolicy{
+		attempts:  opts.RetryAttempts,
+		baseDelay: opts.RetryBaseDelay,
+		sleep:     sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// delay returns a random backoff of up to baseDelay * 2^(attempt-1), so
+// parallel workers don't retry in lockstep
+func (p retryPolicy) delay(attempt int) time.Duration {
+	ceiling := p.baseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > maxRetryDelay {
+		ceiling = maxRetryDelay
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// do calls fn until it succeeds, fails with a permanent error or runs out of
+// attempts; fn is told the attempt number so non-idempotent calls can check
+// whether an earlier attempt went through
+func (p retryPolicy) do(ctx context.Context, operation string, fn func(attempt int) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(attempt)
+		if err == nil || !isRetryable(err) || attempt >= p.attempts {
+			return err
+		}
+		delay := p.delay(attempt)
+		slog.WarnContext(ctx, "retrying CF API call", "operation", operation, "delay", delay, "attempt", attempt, "attempts", p.attempts, "error", err)
+		if sleepErr := p.sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// retryValue is do for calls that return a value
+func retryValue[T any](ctx context.Context, p retryPolicy, operation string, fn func(attempt int) (T, error)) (T, error) {
+	var result T
+	err := p.do(ctx, operation, func(attempt int) error {
+		var err error
+		result, err = fn(attempt)
+		return err
+	})
+	return result, err
+}
+
+// isRetryable reports whether an error from the CF API or UAA is likely to
+// go away on its own: 5xx and rate limit responses, token endpoint failures
+// and dropped connections. Cancelled contexts and other client errors are
+// permanent.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var httpErr client.CloudFoundryHTTPError
+	if errors.As(err, &httpErr) {
+		return isRetryableStatus(httpErr.StatusCode)
+	}
+
+	if resource.IsServiceUnavailableError(err) ||
+		resource.IsRateLimitExceededError(err) ||
+		resource.IsIPBasedRateLimitExceededError(err) {
+		return true
+	}
+	var cfErr resource.CloudFoundryError
+	if errors.As(err, &cfErr) {
+		// CF reports unexpected 500s as a decoded UnknownError
+		return resource.IsServerError(err)
+	}
+
+	var oauthErr *oauth2.RetrieveError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Response != nil && isRetryableStatus(oauthErr.Response.StatusCode)
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// withRetries wraps each client so its calls are retried with policy
+func withRetries(cfClient *cfResourceClient, policy retryPolicy) *cfResourceClient {
+	return &cfResourceClient{
+		Applications:              &retryApplications{next: cfClient.Applications, policy: policy},
+		AuditEvents:               &retryAuditEvents{next: cfClient.AuditEvents, policy: policy},
+		Organizations:             &retryOrganizations{next: cfClient.Organizations, policy: policy},
+		OrganizationQuotas:        &retryOrganizationQuotas{next: cfClient.OrganizationQuotas, policy: policy},
+		Packages:                  &retryPackages{next: cfClient.Packages, policy: policy},
+		Processes:                 &retryProcesses{next: cfClient.Processes, policy: policy},
+		Roles:                     &retryRoles{next: cfClient.Roles, policy: policy},
+		Routes:                    &retryRoutes{next: cfClient.Routes, policy: policy},
+		ServiceCredentialBindings: &retryServiceCredentialBindings{next: cfClient.ServiceCredentialBindings, policy: policy},
+		ServiceInstances:          &retryServiceInstances{next: cfClient.ServiceInstances, policy: policy},
+		ServicePlans:              &retryServicePlans{next: cfClient.ServicePlans, policy: policy},
+		Spaces:                    &retrySpaces{next: cfClient.Spaces, policy: policy},
+		SpaceQuotas:               &retrySpaceQuotas{next: cfClient.SpaceQuotas, policy: policy},
+		Tasks:                     &retryTasks{next: cfClient.Tasks, policy: policy},
+		Users:                     &retryUsers{next: cfClient.Users, policy: policy},
+		Jobs:                      &retryJobs{next: cfClient.Jobs, policy: policy},
+	}
+}
+
+type retryApplications struct {
+	next   ApplicationsClient
+	policy retryPolicy
+}
+
+// Delete treats a missing app as deleted when retrying, since an attempt
+// that timed out may still have deleted it
+func (c *retryApplications) Delete(ctx context.Context, guid string) (string, error) {
+	return retryValue(ctx, c.policy, "delete app", func(attempt int) (string, error) {
+		jobGUID, err := c.next.Delete(ctx, guid)
+		if attempt > 1 && (resource.IsResourceNotFoundError(err) || resource.IsAppNotFoundError(err)) {
+			return "", nil
+		}
+		return jobGUID, err
+	})
+}
+
+func (c *retryApplications) GetEnvironmentVariables(ctx context.Context, guid string) (map[string]*string, error) {
+	return retryValue(ctx, c.policy, "get app env", func(int) (map[string]*string, error) {
+		return c.next.GetEnvironmentVariables(ctx, guid)
+	})
+}
+
+func (c *retryApplications) ListAll(ctx context.Context, opts *client.AppListOptions) ([]*resource.App, error) {
+	return retryValue(ctx, c.policy, "list apps", func(int) ([]*resource.App, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+type retryAuditEvents struct {
+	next   AuditEventsClient
+	policy retryPolicy
+}
+
+func (c *retryAuditEvents) ListAll(ctx context.Context, opts *client.AuditEventListOptions) ([]*resource.AuditEvent, error) {
+	return retryValue(ctx, c.policy, "list audit events", func(int) ([]*resource.AuditEvent, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+type retryOrganizations struct {
+	next   OrganizationsClient
+	policy retryPolicy
+}
+
+func (c *retryOrganizations) ListAll(ctx context.Context, opts *client.OrganizationListOptions) ([]*resource.Organization, error) {
+	return retryValue(ctx, c.policy, "list orgs", func(int) ([]*resource.Organization, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+func (c *retryOrganizations) Single(ctx context.Context, opts *client.OrganizationListOptions) (*resource.Organization, error) {
+	return retryValue(ctx, c.policy, "get org", func(int) (*resource.Organization, error) {
+		return c.next.Single(ctx, opts)
+	})
+}
+
+type retryOrganizationQuotas struct {
+	next   OrganizationQuotasClient
+	policy retryPolicy
+}
+
+func (c *retryOrganizationQuotas) Single(ctx context.Context, opts *client.OrganizationQuotaListOptions) (*resource.OrganizationQuota, error) {
+	return retryValue(ctx, c.policy, "get org quota", func(int) (*resource.OrganizationQuota, error) {
+		return c.next.Single(ctx, opts)
+	})
+}
+
+type retryPackages struct {
+	next   PackagesClient
+	policy retryPolicy
+}
+
+func (c *retryPackages) ListForAppAll(ctx context.Context, appGUID string, opts *client.PackageListOptions) ([]*resource.Package, error) {
+	return retryValue(ctx, c.policy, "list packages", func(int) ([]*resource.Package, error) {
+		return c.next.ListForAppAll(ctx, appGUID, opts)
+	})
+}
+
+type retryProcesses struct {
+	next   ProcessesClient
+	policy retryPolicy
+}
+
+func (c *retryProcesses) ListForAppAll(ctx context.Context, appGUID string, opts *client.ProcessListOptions) ([]*resource.Process, error) {
+	return retryValue(ctx, c.policy, "list processes", func(int) ([]*resource.Process, error) {
+		return c.next.ListForAppAll(ctx, appGUID, opts)
+	})
+}
+
+type retryRoles struct {
+	next   RolesClient
+	policy retryPolicy
+}
+
+// CreateSpaceRole checks for the role before retrying, since an attempt that
+// timed out may still have created it
+func (c *retryRoles) CreateSpaceRole(ctx context.Context, spaceGUID, userGUID string, roleType resource.SpaceRoleType) (*resource.Role, error) {
+	return retryValue(ctx, c.policy, "create space role", func(attempt int) (*resource.Role, error) {
+		if attempt > 1 {
+			listOpts := client.NewRoleListOptions()
+			listOpts.SpaceGUIDs.EqualTo(spaceGUID)
+			listOpts.UserGUIDs.EqualTo(userGUID)
+			listOpts.Types.EqualTo(roleType.String())
+			roles, _, err := c.next.ListIncludeUsersAll(ctx, listOpts)
+			if err != nil {
+				return nil, err
+			}
+			if len(roles) > 0 {
+				return roles[0], nil
+			}
+		}
+		return c.next.CreateSpaceRole(ctx, spaceGUID, userGUID, roleType)
+	})
+}
+
+func (c *retryRoles) ListIncludeUsersAll(ctx context.Context, opts *client.RoleListOptions) ([]*resource.Role, []*resource.User, error) {
+	var users []*resource.User
+	roles, err := retryValue(ctx, c.policy, "list roles", func(int) ([]*resource.Role, error) {
+		var roles []*resource.Role
+		var err error
+		roles, users, err = c.next.ListIncludeUsersAll(ctx, opts)
+		return roles, err
+	})
+	return roles, users, err
+}
+
+type retryRoutes struct {
+	next   RoutesClient
+	policy retryPolicy
+}
+
+// Delete treats a missing route as deleted when retrying, since an attempt
+// that timed out may still have deleted it
+func (c *retryRoutes) Delete(ctx context.Context, guid string) (string, error) {
+	return retryValue(ctx, c.policy, "delete route", func(attempt int) (string, error) {
+		jobGUID, err := c.next.Delete(ctx, guid)
+		if attempt > 1 && (resource.IsResourceNotFoundError(err) || resource.IsRouteNotFoundError(err)) {
+			return "", nil
+		}
+		return jobGUID, err
+	})
+}
+
+func (c *retryRoutes) ListAll(ctx context.Context, opts *client.RouteListOptions) ([]*resource.Route, error) {
+	return retryValue(ctx, c.policy, "list routes", func(int) ([]*resource.Route, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+type retryServiceCredentialBindings struct {
+	next   ServiceCredentialBindingsClient
+	policy retryPolicy
+}
+
+func (c *retryServiceCredentialBindings) ListAll(ctx context.Context, opts *client.ServiceCredentialBindingListOptions) ([]*resource.ServiceCredentialBinding, error) {
+	return retryValue(ctx, c.policy, "list service credential bindings", func(int) ([]*resource.ServiceCredentialBinding, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+type retryServiceInstances struct {
+	next   ServiceInstancesClient
+	policy retryPolicy
+}
+
+func (c *retryServiceInstances) ListAll(ctx context.Context, opts *client.ServiceInstanceListOptions) ([]*resource.ServiceInstance, error) {
+	return retryValue(ctx, c.policy, "list service instances", func(int) ([]*resource.ServiceInstance, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+type retryServicePlans struct {
+	next   ServicePlansClient
+	policy retryPolicy
+}
+
+func (c *retryServicePlans) ListIncludeServiceOfferingAll(ctx context.Context, opts *client.ServicePlanListOptions) ([]*resource.ServicePlan, []*resource.ServiceOffering, error) {
+	var offerings []*resource.ServiceOffering
+	plans, err := retryValue(ctx, c.policy, "list service plans", func(int) ([]*resource.ServicePlan, error) {
+		var plans []*resource.ServicePlan
+		var err error
+		plans, offerings, err = c.next.ListIncludeServiceOfferingAll(ctx, opts)
+		return plans, err
+	})
+	return plans, offerings, err
+}
+
+type retrySpaces struct {
+	next   SpacesClient
+	policy retryPolicy
+}
+
+func (c *retrySpaces) ListAll(ctx context.Context, opts *client.SpaceListOptions) ([]*resource.Space, error) {
+	return retryValue(ctx, c.policy, "list spaces", func(int) ([]*resource.Space, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+func (c *retrySpaces) ListUsersAll(ctx context.Context, spaceGUID string, opts *client.UserListOptions) ([]*resource.User, error) {
+	return retryValue(ctx, c.policy, "list space users", func(int) ([]*resource.User, error) {
+		return c.next.ListUsersAll(ctx, spaceGUID, opts)
+	})
+}
+
+// Create looks for a space with the same name before retrying, since an
+// attempt that timed out may still have created it
+func (c *retrySpaces) Create(ctx context.Context, r *resource.SpaceCreate) (*resource.Space, error) {
+	return retryValue(ctx, c.policy, "create space", func(attempt int) (*resource.Space, error) {
+		if attempt > 1 && r.Relationships != nil && r.Relationships.Organization != nil && r.Relationships.Organization.Data != nil {
+			listOpts := client.NewSpaceListOptions()
+			listOpts.OrganizationGUIDs.EqualTo(r.Relationships.Organization.Data.GUID)
+			listOpts.Names.EqualTo(r.Name)
+			spaces, err := c.next.ListAll(ctx, listOpts)
+			if err != nil {
+				return nil, err
+			}
+			if len(spaces) > 0 {
+				return spaces[0], nil
+			}
+		}
+		return c.next.Create(ctx, r)
+	})
+}
+
+// Delete treats a missing space as deleted when retrying, since an attempt
+// that timed out may still have deleted it
+func (c *retrySpaces) Delete(ctx context.Context, guid string) (string, error) {
+	return retryValue(ctx, c.policy, "delete space", func(attempt int) (string, error) {
+		jobGUID, err := c.next.Delete(ctx, guid)
+		if attempt > 1 && (resource.IsResourceNotFoundError(err) || resource.IsSpaceNotFoundError(err)) {
+			return "", nil
+		}
+		return jobGUID, err
+	})
+}
+
+func (c *retrySpaces) Single(ctx context.Context, opts *client.SpaceListOptions) (*resource.Space, error) {
+	return retryValue(ctx, c.policy, "get space", func(int) (*resource.Space, error) {
+		return c.next.Single(ctx, opts)
+	})
+}
+
+type retrySpaceQuotas struct {
+	next   SpaceQuotasClient
+	policy retryPolicy
+}
+
+func (c *retrySpaceQuotas) Single(ctx context.Context, opts *client.SpaceQuotaListOptions) (*resource.SpaceQuota, error) {
+	return retryValue(ctx, c.policy, "get space quota", func(int) (*resource.SpaceQuota, error) {
+		return c.next.Single(ctx, opts)
+	})
+}
+
+func (c *retrySpaceQuotas) Apply(ctx context.Context, guid string, spaceGUIDs []string) ([]string, error) {
+	return retryValue(ctx, c.policy, "apply space quota", func(int) ([]string, error) {
+		return c.next.Apply(ctx, guid, spaceGUIDs)
+	})
+}
+
+type retryTasks struct {
+	next   TasksClient
+	policy retryPolicy
+}
+
+func (c *retryTasks) ListAll(ctx context.Context, opts *client.TaskListOptions) ([]*resource.Task, error) {
+	return retryValue(ctx, c.policy, "list tasks", func(int) ([]*resource.Task, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+type retryUsers struct {
+	next   UsersClient
+	policy retryPolicy
+}
+
+func (c *retryUsers) ListAll(ctx context.Context, opts *client.UserListOptions) ([]*resource.User, error) {
+	return retryValue(ctx, c.policy, "list users", func(int) ([]*resource.User, error) {
+		return c.next.ListAll(ctx, opts)
+	})
+}
+
+type retryJobs struct {
+	next   JobsClient
+	policy retryPolicy
+}
+
+func (c *retryJobs) Get(ctx context.Context, guid string) (*resource.Job, error) {
+	return retryValue(ctx, c.policy, "get job", func(int) (*resource.Job, error) {
+		return c.next.Get(ctx, guid)
+	})
+}
+
+// PollComplete retries polling errors, but not timeouts or failed jobs
+func (c *retryJobs) PollComplete(ctx context.Context, jobGUID string, opts *client.PollingOptions) error {
+	return c.policy.do(ctx, fmt.Sprintf("poll job %s", jobGUID), func(int) error {
+		return c.next.PollComplete(ctx, jobGUID, opts)
+	})
+}
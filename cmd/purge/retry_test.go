@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"golang.org/x/oauth2"
+)
+
+func newTestRetryPolicy(attempts int) retryPolicy {
+	return retryPolicy{
+		attempts:  attempts,
+		baseDelay: time.Second,
+		sleep:     func(context.Context, time.Duration) error { return nil },
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"bad gateway": {
+			err:      client.CloudFoundryHTTPError{StatusCode: http.StatusBadGateway},
+			expected: true,
+		},
+		"wrapped bad gateway": {
+			err:      fmt.Errorf("error listing orgs: %w", client.CloudFoundryHTTPError{StatusCode: http.StatusBadGateway}),
+			expected: true,
+		},
+		"not found": {
+			err: client.CloudFoundryHTTPError{StatusCode: http.StatusNotFound},
+		},
+		"service unavailable": {
+			err:      resource.NewServiceUnavailableError(),
+			expected: true,
+		},
+		"rate limited": {
+			err:      resource.NewRateLimitExceededError(),
+			expected: true,
+		},
+		"unprocessable entity": {
+			err: resource.NewUnprocessableEntityError(),
+		},
+		"unknown server error": {
+			err:      resource.CloudFoundryError{Code: 10001, Title: "UnknownError", Detail: "An unknown error occurred."},
+			expected: true,
+		},
+		"space not found": {
+			err: resource.NewSpaceNotFoundError(),
+		},
+		"token endpoint unavailable": {
+			err:      &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}},
+			expected: true,
+		},
+		"bad credentials": {
+			err: &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusUnauthorized}},
+		},
+		"dropped connection": {
+			err:      &url.Error{Op: "Get", URL: "https://api.example.com", Err: errors.New("connection reset by peer")},
+			expected: true,
+		},
+		"cancelled": {
+			err: fmt.Errorf("error executing request: %w", context.Canceled),
+		},
+		"other": {
+			err: errors.New("boom"),
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := isRetryable(test.err); got != test.expected {
+				t.Errorf("expected retryable %t, got %t", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	transient := client.CloudFoundryHTTPError{StatusCode: http.StatusBadGateway}
+	permanent := resource.NewUnprocessableEntityError()
+
+	testCases := map[string]struct {
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		"succeeds after transient errors": {
+			errs:             []error{transient, transient, nil},
+			expectedAttempts: 3,
+		},
+		"stops on permanent errors": {
+			errs:             []error{transient, permanent, nil},
+			expectedAttempts: 2,
+			expectedErr:      permanent,
+		},
+		"gives up after the last attempt": {
+			errs:             []error{transient, transient, transient, nil},
+			expectedAttempts: 3,
+			expectedErr:      transient,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			err := newTestRetryPolicy(3).do(context.Background(), "test", func(attempt int) error {
+				attempts++
+				return test.errs[attempt-1]
+			})
+			// CloudFoundryHTTPError isn't comparable, so compare messages
+			if fmt.Sprint(err) != fmt.Sprint(test.expectedErr) {
+				t.Errorf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", test.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := newTestRetryPolicy(10)
+	for attempt := 1; attempt <= 10; attempt++ {
+		ceiling := min(policy.baseDelay<<(attempt-1), maxRetryDelay)
+		if delay := policy.delay(attempt); delay < 0 || delay > ceiling {
+			t.Errorf("attempt %d: expected delay up to %s, got %s", attempt, ceiling, delay)
+		}
+	}
+}
+
+// lostResponseSpaces creates spaces but reports a gateway error the first
+// time, as if the response was lost
+type lostResponseSpaces struct {
+	SpacesClient
+	spaces      []*resource.Space
+	createCalls int
+}
+
+func (s *lostResponseSpaces) Create(ctx context.Context, r *resource.SpaceCreate) (*resource.Space, error) {
+	s.createCalls++
+	space := &resource.Space{GUID: fmt.Sprintf("space-%d", s.createCalls), Name: r.Name}
+	s.spaces = append(s.spaces, space)
+	if s.createCalls == 1 {
+		return nil, client.CloudFoundryHTTPError{StatusCode: http.StatusGatewayTimeout}
+	}
+	return space, nil
+}
+
+func (s *lostResponseSpaces) ListAll(ctx context.Context, opts *client.SpaceListOptions) ([]*resource.Space, error) {
+	return s.spaces, nil
+}
+
+func TestRetrySpaceCreate(t *testing.T) {
+	spaces := &lostResponseSpaces{}
+	cfClient := withRetries(&cfResourceClient{Spaces: spaces}, newTestRetryPolicy(3))
+
+	space, err := cfClient.Spaces.Create(context.Background(), &resource.SpaceCreate{
+		Name: "space-1",
+		Relationships: &resource.SpaceRelationships{
+			Organization: &resource.ToOneRelationship{
+				Data: &resource.Relationship{GUID: "org-1"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if spaces.createCalls != 1 {
+		t.Errorf("expected 1 create call, got %d", spaces.createCalls)
+	}
+	if space.GUID != "space-1" {
+		t.Errorf("expected the space created by the first attempt, got %s", space.GUID)
+	}
+}
+
+// lostResponseDeletes deletes spaces but reports a gateway error the first
+// time, as if the response was lost
+type lostResponseDeletes struct {
+	SpacesClient
+	deleted     bool
+	deleteCalls int
+}
+
+func (s *lostResponseDeletes) Delete(ctx context.Context, guid string) (string, error) {
+	s.deleteCalls++
+	if s.deleted {
+		return "", resource.NewSpaceNotFoundError()
+	}
+	s.deleted = true
+	return "", client.CloudFoundryHTTPError{StatusCode: http.StatusGatewayTimeout}
+}
+
+func TestRetrySpaceDelete(t *testing.T) {
+	spaces := &lostResponseDeletes{}
+	cfClient := withRetries(&cfResourceClient{Spaces: spaces}, newTestRetryPolicy(3))
+
+	if _, err := cfClient.Spaces.Delete(context.Background(), "space-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if spaces.deleteCalls != 2 {
+		t.Errorf("expected 2 delete calls, got %d", spaces.deleteCalls)
+	}
+
+	// A missing space on the first attempt is still an error
+	spaces = &lostResponseDeletes{deleted: true}
+	cfClient = withRetries(&cfResourceClient{Spaces: spaces}, newTestRetryPolicy(3))
+	if _, err := cfClient.Spaces.Delete(context.Background(), "space-1"); !resource.IsSpaceNotFoundError(err) {
+		t.Errorf("expected a space not found error, got %v", err)
+	}
+}
+
+func TestNewRetryingCFClient(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"links": {"uaa": {"href": "https://uaa.example.gov"}, "login": {"href": "https://login.example.gov"}}}`)
+	}))
+	defer server.Close()
+
+	_, err := newRetryingCFClient(Options{
+		APIAddress:     server.URL,
+		ClientID:       "purge",
+		ClientSecret:   "secret",
+		RetryAttempts:  3,
+		RetryBaseDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected the API root to be fetched twice, got %d", requests)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+// OrphanedRoutes describes old routes left in a space without apps or services
+type OrphanedRoutes struct {
+	Space  *resource.Space
+	Routes []*resource.Route
+}
+
+// listOrphanedRoutes identifies spaces with no apps or service instances whose
+// routes are older than opts.OrphanedRouteDays and mapped to no apps, skipping
+// exempt spaces and spaces that will be purged; a route shared with another
+// space may still be mapped to an app there
+func listOrphanedRoutes(
+	ctx context.Context,
+	org *resource.Organization,
+	resources orgResources,
+	opts Options,
+	now time.Time,
+	toPurge []SpaceDetails,
+) []OrphanedRoutes {
+	if opts.OrphanedRouteDays <= 0 {
+		return nil
+	}
+
+	skip := map[string]bool{}
+	for _, details := range toPurge {
+		skip[details.Space.GUID] = true
+	}
+	for _, app := range resources.Apps {
+		skip[getRelationshipGUID(&app.Relationships.Space)] = true
+	}
+	for _, instance := range resources.Instances {
+		skip[getRelationshipGUID(instance.Relationships.Space)] = true
+	}
+
+	cutoff := now.Add(-24 * time.Duration(opts.OrphanedRouteDays) * time.Hour)
+
+	var orphaned []OrphanedRoutes
+	for _, space := range resources.Spaces {
+		if skip[space.GUID] {
+			continue
+		}
+
+		var routes []*resource.Route
+		for _, route := range resources.Routes {
+			if getRelationshipGUID(&route.Relationships.Space) == space.GUID && len(route.Destinations) == 0 && !route.CreatedAt.After(cutoff) {
+				routes = append(routes, route)
+			}
+		}
+		if len(routes) == 0 {
+			continue
+		}
+
+		exempt, err := getSpaceExemption(org, space, now)
+		if err != nil {
+			slog.WarnContext(ctx, "skipping orphaned routes in space with invalid exemption", "space", space.Name, "space_guid", space.GUID, "error", err)
+			continue
+		}
+		if exempt != nil {
+			slog.InfoContext(ctx, "skipping orphaned routes in exempt space", "space", space.Name, "space_guid", space.GUID, "exempt_source", exempt.Source, "exempt_until", exempt.Until, "exempt_reason", exempt.Reason)
+			continue
+		}
+
+		orphaned = append(orphaned, OrphanedRoutes{Space: space, Routes: routes})
+	}
+	return orphaned
+}
+
+// deleteOrphanedRoutes deletes the orphaned routes in a space and emails the space users
+func deleteOrphanedRoutes(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	org *resource.Organization,
+	orphaned OrphanedRoutes,
+	members spaceMembers,
+	mailSender mailer,
+) error {
+	recipients := members.Recipients
+
+	slog.InfoContext(ctx, "deleting orphaned routes", "space", orphaned.Space.Name, "routes", len(orphaned.Routes), "recipients", recipients)
+	if opts.DryRun {
+		return nil
+	}
+
+	for _, route := range orphaned.Routes {
+		jobGUID, err := cfClient.Routes.Delete(ctx, route.GUID)
+		if err != nil {
+			return fmt.Errorf("error deleting route %s in space %s: %w", route.URL, orphaned.Space.Name, err)
+		}
+		if jobGUID != "" {
+			if err := cfClient.Jobs.PollComplete(ctx, jobGUID, client.NewPollingOptions()); err != nil {
+				return fmt.Errorf("error waiting for delete job %s for route %s: %w", jobGUID, route.URL, err)
+			}
+		}
+	}
+
+	routesTemplate, err := template.ParseFiles("../../templates/base.html", "../../templates/routes.tmpl")
+	if err != nil {
+		return fmt.Errorf("error reading routes template: %w", err)
+	}
+
+	data := map[string]interface{}{
+		"org":    org,
+		"space":  orphaned.Space,
+		"routes": orphaned.Routes,
+		"days":   opts.OrphanedRouteDays,
+	}
+	body, err := renderTemplate(routesTemplate, data)
+	if err != nil {
+		return fmt.Errorf("error rendering email: %w", err)
+	}
+
+	slog.InfoContext(ctx, "sending email", "subject", opts.RoutesMailSubject, "recipients", recipients)
+	slog.DebugContext(ctx, "email body", "body", body)
+	if err := mailSender.sendMail(opts.SMTPOptions, opts.MailSender, opts.RoutesMailSubject, body, recipients); err != nil {
+		return fmt.Errorf("error sending mail on space %s: %w", orphaned.Space.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockRoutes struct {
+	routes        []*resource.Route
+	deleteJobGUID string
+	deleteErr     error
+	deletedGUIDs  []string
+}
+
+func (r *mockRoutes) Delete(ctx context.Context, guid string) (string, error) {
+	r.deletedGUIDs = append(r.deletedGUIDs, guid)
+	return r.deleteJobGUID, r.deleteErr
+}
+
+func (r *mockRoutes) ListAll(ctx context.Context, opts *client.RouteListOptions) ([]*resource.Route, error) {
+	return r.routes, nil
+}
+
+func newSpaceRoute(guid string, spaceGUID string, createdAt time.Time) *resource.Route {
+	return &resource.Route{
+		GUID: guid,
+		URL:  guid + ".app.cloud.gov",
+		Relationships: resource.RouteRelationships{
+			Space: resource.ToOneRelationship{
+				Data: &resource.Relationship{
+					GUID: spaceGUID,
+				},
+			},
+		},
+		CreatedAt: createdAt,
+	}
+}
+
+func TestListOrphanedRoutes(t *testing.T) {
+	now := time.Now().Truncate(24 * time.Hour)
+	oldRoute := newSpaceRoute("old-route", "space-guid", now.Add(-10*24*time.Hour))
+	newRoute := newSpaceRoute("new-route", "space-guid", now.Add(-2*24*time.Hour))
+	sharedRoute := newSpaceRoute("shared-route", "space-guid", now.Add(-10*24*time.Hour))
+	appGUID := "other-space-app-guid"
+	sharedRoute.Destinations = []resource.RouteDestination{{App: resource.RouteDestinationApp{GUID: &appGUID}}}
+
+	testCases := map[string]struct {
+		resources        orgResources
+		opts             Options
+		toPurge          []SpaceDetails
+		expectedOrphaned []OrphanedRoutes
+	}{
+		"disabled by default": {
+			resources: orgResources{
+				Spaces: []*resource.Space{{GUID: "space-guid"}},
+				Routes: []*resource.Route{oldRoute},
+			},
+		},
+		"lists old routes in spaces without apps or services": {
+			resources: orgResources{
+				Spaces: []*resource.Space{{GUID: "space-guid"}},
+				Routes: []*resource.Route{oldRoute, newRoute},
+			},
+			opts: Options{OrphanedRouteDays: 7},
+			expectedOrphaned: []OrphanedRoutes{
+				{
+					Space:  &resource.Space{GUID: "space-guid"},
+					Routes: []*resource.Route{oldRoute},
+				},
+			},
+		},
+		"skips routes mapped to apps in other spaces": {
+			resources: orgResources{
+				Spaces: []*resource.Space{{GUID: "space-guid"}},
+				Routes: []*resource.Route{oldRoute, sharedRoute},
+			},
+			opts: Options{OrphanedRouteDays: 7},
+			expectedOrphaned: []OrphanedRoutes{
+				{
+					Space:  &resource.Space{GUID: "space-guid"},
+					Routes: []*resource.Route{oldRoute},
+				},
+			},
+		},
+		"skips spaces with apps": {
+			resources: orgResources{
+				Spaces: []*resource.Space{{GUID: "space-guid"}},
+				Apps: []*resource.App{
+					{
+						GUID: "app-guid",
+						Relationships: resource.SpaceRelationship{
+							Space: resource.ToOneRelationship{
+								Data: &resource.Relationship{
+									GUID: "space-guid",
+								},
+							},
+						},
+					},
+				},
+				Routes: []*resource.Route{oldRoute},
+			},
+			opts: Options{OrphanedRouteDays: 7},
+		},
+		"skips spaces with service instances": {
+			resources: orgResources{
+				Spaces: []*resource.Space{{GUID: "space-guid"}},
+				Instances: []*resource.ServiceInstance{
+					{
+						GUID: "instance-guid",
+						Relationships: resource.ServiceInstanceRelationships{
+							Space: &resource.ToOneRelationship{
+								Data: &resource.Relationship{
+									GUID: "space-guid",
+								},
+							},
+						},
+					},
+				},
+				Routes: []*resource.Route{oldRoute},
+			},
+			opts: Options{OrphanedRouteDays: 7},
+		},
+		"skips spaces that will be purged": {
+			resources: orgResources{
+				Spaces: []*resource.Space{{GUID: "space-guid"}},
+				Routes: []*resource.Route{oldRoute},
+			},
+			opts: Options{OrphanedRouteDays: 7},
+			toPurge: []SpaceDetails{
+				{Space: &resource.Space{GUID: "space-guid"}},
+			},
+		},
+		"skips exempt spaces": {
+			resources: orgResources{
+				Spaces: []*resource.Space{
+					{
+						GUID:     "space-guid",
+						Metadata: resource.NewMetadata().WithAnnotation("", exemptUntilKey, now.Format(exemptDateLayout)),
+					},
+				},
+				Routes: []*resource.Route{oldRoute},
+			},
+			opts: Options{OrphanedRouteDays: 7},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			orphaned := listOrphanedRoutes(context.Background(), nil, test.resources, test.opts, now, test.toPurge)
+			if diff := cmp.Diff(test.expectedOrphaned, orphaned); diff != "" {
+				t.Errorf("ListOrphanedRoutes() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeleteOrphanedRoutes(t *testing.T) {
+	deleteErr := errors.New("delete route error")
+	orphaned := OrphanedRoutes{
+		Space: &resource.Space{GUID: "space-guid", Name: "space"},
+		Routes: []*resource.Route{
+			newSpaceRoute("route-1", "space-guid", time.Time{}),
+			newSpaceRoute("route-2", "space-guid", time.Time{}),
+		},
+	}
+
+	testCases := map[string]struct {
+		routes               *mockRoutes
+		opts                 Options
+		expectedErr          error
+		expectedDeletedGUIDs []string
+	}{
+		"deletes routes": {
+			routes: &mockRoutes{
+				deleteJobGUID: "delete-job",
+			},
+			expectedDeletedGUIDs: []string{"route-1", "route-2"},
+		},
+		"does not delete routes on dry run": {
+			routes: &mockRoutes{},
+			opts:   Options{DryRun: true},
+		},
+		"stops on delete error": {
+			routes: &mockRoutes{
+				deleteErr: deleteErr,
+			},
+			expectedErr:          deleteErr,
+			expectedDeletedGUIDs: []string{"route-1"},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfClient := &cfResourceClient{
+				Routes: test.routes,
+				Jobs: &mockJobs{
+					expectedJobGUID: "delete-job",
+				},
+			}
+
+			err := deleteOrphanedRoutes(
+				context.Background(),
+				cfClient,
+				test.opts,
+				&resource.Organization{Name: "org"},
+				orphaned,
+				spaceMembers{Recipients: []string{"foo@bar.gov"}},
+				&mockMailSender{},
+			)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error: %s, got: %s", test.expectedErr, err)
+			}
+			if diff := cmp.Diff(test.expectedDeletedGUIDs, test.routes.deletedGUIDs); diff != "" {
+				t.Errorf("deleted routes mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
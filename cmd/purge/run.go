@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ErrRunStopped = errors.New("run stopped before this action started")
+
+// runner holds the clients and stores shared by every run, so serve can
+// reuse them between scheduled runs; the CF client is built by the first
+// reloadSecrets, since creating it calls the API
+type runner struct {
+	foundation string
+	cfClient   *cfResourceClient
+	opts       Options
+	policy     *Policy
+	ledger     *notifyLedger
+	snapshots  *snapshotStore
+	exports    *exportStore
+	cipher     *artifactCipher
+	metrics    *runMetrics
+	mailSender mailer
+
+	// newClient builds cfClient, and rebuilds it when its secret is rotated
+	newClient func(opts Options) (*cfResourceClient, error)
+}
+
+// newRunner opens the state files for one foundation
+func newRunner(
+	foundation string,
+	opts Options,
+	policy *Policy,
+	cipher *artifactCipher,
+	mailSender mailer,
+	registry *prometheus.Registry,
+) (*runner, error) {
+	if err := readSecretFiles(&opts); err != nil {
+		return nil, err
+	}
+
+	var ledger *notifyLedger
+	var err error
+	if opts.LedgerFile != "" {
+		ledger, err = loadNotifyLedger(opts.LedgerFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading ledger: %w", err)
+		}
+	}
+
+	var snapshots *snapshotStore
+	if opts.SnapshotDir != "" {
+		snapshots, err = newSnapshotStore(opts.SnapshotDir, cipher)
+		if err != nil {
+			return nil, fmt.Errorf("error opening snapshots: %w", err)
+		}
+	}
+
+	var exports *exportStore
+	if opts.ExportDir != "" {
+		exports, err = newExportStore(opts.ExportDir, cipher)
+		if err != nil {
+			return nil, fmt.Errorf("error opening exports: %w", err)
+		}
+	}
+
+	metrics := newFoundationMetrics(registry, foundation)
+	return &runner{
+		foundation: foundation,
+		opts:       opts,
+		policy:     policy,
+		ledger:     ledger,
+		snapshots:  snapshots,
+		exports:    exports,
+		cipher:     cipher,
+		metrics:    metrics,
+		mailSender: &metricsMailer{mailer: mailSender, emails: metrics.emails},
+		newClient:  newRetryingCFClient,
+	}, nil
+}
+
+// reloadSecrets re-reads secrets from their _FILE variants so a rotated
+// secret is picked up without a restart, building the CF client if there
+// isn't one yet or the client secret changed
+func (r *runner) reloadSecrets() error {
+	opts := r.opts
+	if err := readSecretFiles(&opts); err != nil {
+		return err
+	}
+	if r.cfClient == nil || opts.ClientSecret != r.opts.ClientSecret {
+		cfClient, err := r.newClient(opts)
+		if err != nil {
+			return fmt.Errorf("error creating client: %w", err)
+		}
+		r.cfClient = cfClient
+	}
+	r.opts = opts
+	return nil
+}
+
+// run builds a plan for the run, plan, apply, notify and purge commands and
+// carries it out; plan returns a nil summary since nothing is applied
+func (r *runner) run(ctx context.Context, cmd cliCommand) (*runSummary, error) {
+	opts := r.opts
+	ctx = withLogAttrs(ctx, "run_id", newRunID(), "phase", "list")
+	if r.foundation != "" {
+		ctx = withLogAttrs(ctx, "foundation", r.foundation)
+	}
+	planFile := foundationFile(cmd.PlanFile, r.foundation)
+
+	orgs, err := listSandboxOrgs(ctx, r.cfClient, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error getting orgs: %w", err)
+	}
+
+	userGUIDs, err := listUserGUIDs(ctx, r.cfClient)
+	if err != nil {
+		return nil, fmt.Errorf("error getting users: %w", err)
+	}
+
+	now := time.Now().Truncate(24 * time.Hour)
+
+	// Finish purges interrupted by an earlier run before planning new ones
+	switch cmd.Name {
+	case commandRun, commandPurge, commandApply:
+		if !opts.DryRun {
+			ctx := withLogAttrs(ctx, "phase", "recover")
+			if err := recoverPurges(ctx, r.cfClient, opts, r.policy, r.snapshots, r.ledger); err != nil {
+				slog.ErrorContext(ctx, "error recovering interrupted purges", "error", err)
+			}
+		}
+	}
+
+	ctx = withLogAttrs(ctx, "phase", "plan")
+	plan := buildPlan(ctx, r.cfClient, opts, r.policy, userGUIDs, orgs, now)
+	for _, planErr := range plan.listErrors() {
+		slog.ErrorContext(ctx, "error planning", "error", planErr)
+	}
+
+	// Leave spaces that are still being deleted to recovery
+	deleting, err := r.snapshots.listDeleting()
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshots: %w", err)
+	}
+	if len(deleting) > 0 {
+		plan = withoutSpaces(plan, deleting)
+	}
+
+	switch cmd.Name {
+	case commandPlan:
+		for _, violation := range checkPurgeLimits(plan, opts) {
+			slog.WarnContext(ctx, "applying this plan will exceed a safety limit", "violation", violation)
+		}
+		if err := writePlan(planFile, plan, r.cipher); err != nil {
+			return nil, fmt.Errorf("error saving plan: %w", err)
+		}
+		slog.InfoContext(ctx, "wrote plan", "file", planFile)
+		return nil, nil
+	case commandApply:
+		saved, err := readPlan(planFile, r.cipher)
+		if err != nil {
+			return nil, fmt.Errorf("error loading plan: %w", err)
+		}
+		if drift := checkPlanDrift(saved, plan); len(drift) > 0 {
+			return nil, fmt.Errorf("refusing to apply plan %s; live state has drifted: %s", planFile, strings.Join(drift, ", "))
+		}
+		plan = saved
+	case commandNotify:
+		plan = filterPlan(plan, actionNotify)
+	case commandPurge:
+		plan = filterPlan(plan, actionPurge, actionDeleteRoutes)
+	}
+
+	plan, limitErr := enforcePurgeLimits(ctx, plan, opts)
+
+	results := applyPlan(withLogAttrs(ctx, "phase", "apply"), r.cfClient, opts, r.policy, plan, r.ledger, r.snapshots, r.exports, r.mailSender)
+	r.metrics.observeRun(plan, results, opts.DryRun, time.Now())
+	summary := newRunSummary(plan, results)
+	if limitErr != nil {
+		summary.Failures = append(summary.Failures, runFailure{Action: actionPurge, Error: limitErr.Error()})
+	}
+	return &summary, nil
+}
+
+// listUserGUIDs builds a filter of users with email addresses, leaving out
+// service accounts
+func listUserGUIDs(ctx context.Context, cfClient *cfResourceClient) (map[string]bool, error) {
+	users, err := cfClient.Users.ListAll(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	userGUIDs := map[string]bool{}
+	for _, user := range users {
+		if strings.Contains(user.Username, "@") {
+			userGUIDs[user.GUID] = true
+		}
+	}
+	return userGUIDs, nil
+}
@@ -3,9 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/mail"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/cloudfoundry-community/go-cfclient/v3/client"
@@ -13,8 +13,51 @@ import (
 )
 
 type spaceUser struct {
-	GUID     string
-	Username string
+	GUID     string `json:"guid"`
+	Username string `json:"username"`
+}
+
+// spaceMembers describes the users to email about a space and the roles to
+// restore if it is recreated
+type spaceMembers struct {
+	Recipients []string    `json:"recipients"`
+	Developers []spaceUser `json:"developers,omitempty"`
+	Managers   []spaceUser `json:"managers,omitempty"`
+}
+
+// equal reports whether two sets of members match, treating nil and empty
+// lists alike since empty lists are left out of saved plans
+func (m spaceMembers) equal(other spaceMembers) bool {
+	return slices.Equal(m.Recipients, other.Recipients) &&
+		slices.Equal(m.Developers, other.Developers) &&
+		slices.Equal(m.Managers, other.Managers)
+}
+
+// listSpaceMembers lists the recipients, developers and managers of a space
+func listSpaceMembers(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	userGUIDs map[string]bool,
+	space *resource.Space,
+) (spaceMembers, error) {
+	roleListOpts := client.NewRoleListOptions()
+	roleListOpts.SpaceGUIDs.Values = []string{space.GUID}
+	spaceRoles, spaceUsers, err := cfClient.Roles.ListIncludeUsersAll(ctx, roleListOpts)
+	if err != nil {
+		return spaceMembers{}, fmt.Errorf("error listing roles with users on space %s: %w", space.Name, err)
+	}
+
+	recipients, err := listRecipients(userGUIDs, spaceUsers)
+	if err != nil {
+		return spaceMembers{}, fmt.Errorf("error listing recipients on space %s: %w", space.Name, err)
+	}
+
+	developers, managers := listSpaceDevsAndManagers(ctx, userGUIDs, spaceRoles, spaceUsers)
+	return spaceMembers{
+		Recipients: recipients,
+		Developers: developers,
+		Managers:   managers,
+	}, nil
 }
 
 // listRecipients get a list of recipient emails from space users
@@ -37,6 +80,7 @@ func listRecipients(
 }
 
 func listSpaceDevsAndManagers(
+	ctx context.Context,
 	userGUIDs map[string]bool,
 	spaceRoles []*resource.Role,
 	spaceUsers []*resource.User,
@@ -67,7 +111,7 @@ func listSpaceDevsAndManagers(
 		}
 
 		if username == "" {
-			log.Printf("Could not find a username for user GUID %s in role %s", roleUserGUID, role.Type)
+			slog.WarnContext(ctx, "could not find a username for role", "user_guid", roleUserGUID, "role", role.Type)
 			continue
 		}
 
@@ -178,98 +222,93 @@ func purgeSpace(
 	return jobGUID, spaceErr
 }
 
-// listSandboxOrgs lists all sandbox organizations
-func listSandboxOrgs(
-	ctx context.Context,
-	cfClient *cfResourceClient,
-	prefix string,
-) ([]*resource.Organization, error) {
-	sandboxes := []*resource.Organization{}
-
-	orgs, err := cfClient.Organizations.ListAll(ctx, nil)
-	if err != nil {
-		return sandboxes, err
-	}
-
-	for _, org := range orgs {
-		if strings.HasPrefix(org.Name, prefix) {
-			sandboxes = append(sandboxes, org)
-		}
-	}
-
-	return sandboxes, nil
-}
-
-// listOrgResources fetches apps, service instances, and spaces within an organization
+// listOrgResources fetches spaces, apps, service instances and any other
+// resource types counted toward the age of spaces within an organization
 func listOrgResources(
 	ctx context.Context,
 	cfClient *cfResourceClient,
 	org *resource.Organization,
+	opts Options,
+	now time.Time,
 ) (
-	spaces []*resource.Space,
-	apps []*resource.App,
-	instances []*resource.ServiceInstance,
+	resources orgResources,
 	err error,
 ) {
 	appListOptions := client.NewAppListOptions()
 	appListOptions.OrganizationGUIDs.EqualTo(org.GUID)
-	apps, err = cfClient.Applications.ListAll(ctx, appListOptions)
+	resources.Apps, err = cfClient.Applications.ListAll(ctx, appListOptions)
 	if err != nil {
 		return
 	}
 
 	serviceListOptions := client.NewServiceInstanceListOptions()
 	serviceListOptions.OrganizationGUIDs.EqualTo(org.GUID)
-	instances, err = cfClient.ServiceInstances.ListAll(ctx, serviceListOptions)
+	resources.Instances, err = cfClient.ServiceInstances.ListAll(ctx, serviceListOptions)
 	if err != nil {
 		return
 	}
 
 	spaceListOptions := client.NewSpaceListOptions()
 	spaceListOptions.OrganizationGUIDs.EqualTo(org.GUID)
-	spaces, err = cfClient.Spaces.ListAll(ctx, spaceListOptions)
+	resources.Spaces, err = cfClient.Spaces.ListAll(ctx, spaceListOptions)
 	if err != nil {
 		return
 	}
 
+	err = listOptionalOrgResources(ctx, cfClient, org, opts, now, &resources)
 	return
 }
 
 // letFirstResource gets the creation timestamp of the earliest-created resource in a space
 func letFirstResource(
 	space *resource.Space,
-	apps []*resource.App,
-	instances []*resource.ServiceInstance,
+	resources orgResources,
+	types []string,
 ) (time.Time, error) {
-	groupedApps := groupAppsBySpace(apps)
-	groupedInstances := groupInstancesBySpace(instances)
+	return getFirstResource(listSpaceResources(space, resources, types)), nil
+}
 
+// getFirstResource returns the creation time of the earliest resource listed,
+// or zero if every resource is known only from a create event: a space whose
+// users deleted everything is left alone, as the notify email promises
+func getFirstResource(spaceResources []spaceResource) time.Time {
 	var firstResource time.Time
-	for _, app := range groupedApps[space.GUID] {
-		if firstResource.IsZero() || app.CreatedAt.Before(firstResource) {
-			firstResource = app.CreatedAt
-		}
+	if !slices.ContainsFunc(spaceResources, func(r spaceResource) bool { return !r.AuditEvent }) {
+		return firstResource
 	}
-	for _, instance := range groupedInstances[space.GUID] {
-		if firstResource.IsZero() || instance.CreatedAt.Before(firstResource) {
-			firstResource = instance.CreatedAt
+	for _, r := range spaceResources {
+		if firstResource.IsZero() || r.CreatedAt.Before(firstResource) {
+			firstResource = r.CreatedAt
 		}
 	}
+	return firstResource
+}
+
+// getSpaceAge applies TIME_STARTS_AT to the first resource in a space and
+// returns the day the space's clock started and the number of days since
+func getSpaceAge(firstResource, timeStartsAt, now time.Time) (time.Time, int) {
+	if timeStartsAt.After(firstResource) {
+		firstResource = timeStartsAt
+	}
 
-	return firstResource, nil
+	firstResource = firstResource.Truncate(24 * time.Hour)
+	return firstResource, int(now.Sub(firstResource).Hours() / 24)
 }
 
-// SpaceDetails describes a space and its first resource creation time
+// SpaceDetails describes a space, its first resource creation time and, for
+// notifications, the reminder stage to send
 type SpaceDetails struct {
 	Timestamp time.Time
 	Space     *resource.Space
+	Stage     *NotifyStage
 }
 
-// listPurgeSpaces identifies spaces that will be notified or purged
+// listPurgeSpaces identifies spaces that will be notified or purged, skipping
+// spaces exempted by space or org metadata
 func listPurgeSpaces(
-	spaces []*resource.Space,
-	apps []*resource.App,
-	instances []*resource.ServiceInstance,
+	ctx context.Context,
+	org *resource.Organization,
+	resources orgResources,
 	opts Options,
 	now time.Time,
 	timeStartsAt time.Time,
@@ -278,54 +317,32 @@ func listPurgeSpaces(
 	toPurge []SpaceDetails,
 	err error,
 ) {
-	var firstResource time.Time
-	for _, space := range spaces {
-		firstResource, err = letFirstResource(space, apps, instances)
-		if err != nil {
-			return
-		}
+	stages := listNotifyStages(opts)
+
+	spaceResources := groupResourcesBySpace(resources, opts.FirstResourceTypes)
+
+	for _, space := range resources.Spaces {
+		firstResource := getFirstResource(spaceResources[space.GUID])
 		if firstResource.IsZero() {
 			continue
 		}
-		if timeStartsAt.After(firstResource) {
-			firstResource = timeStartsAt
-		}
 
-		firstResource := firstResource.Truncate(24 * time.Hour)
-		delta := int(now.Sub(firstResource).Hours() / 24)
-		if !opts.DisablePurge && delta >= opts.PurgeDays {
-			toPurge = append(toPurge, SpaceDetails{firstResource, space})
-		} else if delta >= opts.NotifyDays {
-			toNotify = append(toNotify, SpaceDetails{firstResource, space})
+		exempt, exemptErr := getSpaceExemption(org, space, now)
+		if exemptErr != nil {
+			slog.WarnContext(ctx, "skipping space with invalid exemption", "space", space.Name, "space_guid", space.GUID, "error", exemptErr)
+			continue
 		}
-	}
-	return
-}
-
-func groupAppsBySpace(apps []*resource.App) map[string][]*resource.App {
-	grouped := map[string][]*resource.App{}
-
-	for _, app := range apps {
-		spaceGuid := app.Relationships.Space.Data.GUID
-		if _, ok := grouped[spaceGuid]; !ok {
-			grouped[spaceGuid] = []*resource.App{}
+		if exempt != nil {
+			slog.InfoContext(ctx, "skipping exempt space", "space", space.Name, "space_guid", space.GUID, "exempt_source", exempt.Source, "exempt_until", exempt.Until, "exempt_reason", exempt.Reason)
+			continue
 		}
-		grouped[spaceGuid] = append(grouped[spaceGuid], app)
-	}
-
-	return grouped
-}
-
-func groupInstancesBySpace(instances []*resource.ServiceInstance) map[string][]*resource.ServiceInstance {
-	grouped := map[string][]*resource.ServiceInstance{}
 
-	for _, instance := range instances {
-		spaceGuid := instance.Relationships.Space.Data.GUID
-		if _, ok := grouped[spaceGuid]; !ok {
-			grouped[spaceGuid] = []*resource.ServiceInstance{}
+		firstResource, delta := getSpaceAge(firstResource, timeStartsAt, now)
+		if !opts.DisablePurge && delta >= opts.PurgeDays {
+			toPurge = append(toPurge, SpaceDetails{Timestamp: firstResource, Space: space})
+		} else if stage := getCurrentNotifyStage(stages, opts.PurgeDays-delta); stage != nil {
+			toNotify = append(toNotify, SpaceDetails{Timestamp: firstResource, Space: space, Stage: stage})
 		}
-		grouped[spaceGuid] = append(grouped[spaceGuid], instance)
 	}
-
-	return grouped
+	return
 }
@@ -213,7 +213,7 @@ func TestListSpaceDevsAndManagers(t *testing.T) {
 	}
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			devs, managers := listSpaceDevsAndManagers(test.userGUIDs, test.roles, test.users)
+			devs, managers := listSpaceDevsAndManagers(context.Background(), test.userGUIDs, test.roles, test.users)
 			if diff := cmp.Diff(test.expectedDevs, devs); diff != "" {
 				t.Errorf("ListSpaceDevsAndManagers() developers mismatch (-want +got):\n%s", diff)
 			}
@@ -227,6 +227,7 @@ func TestListSpaceDevsAndManagers(t *testing.T) {
 func TestListPurgeSpaces(t *testing.T) {
 	now := time.Now()
 	testCases := map[string]struct {
+		org              *resource.Organization
 		spaces           []*resource.Space
 		apps             []*resource.App
 		instances        []*resource.ServiceInstance
@@ -274,7 +275,7 @@ func TestListPurgeSpaces(t *testing.T) {
 			},
 			timeStartsAt: time.Time{},
 		},
-		"notifies on spaces between thresholds": {
+		"keeps notifying after the notify threshold without a ledger": {
 			spaces: []*resource.Space{
 				{GUID: "space-guid"},
 			},
@@ -303,6 +304,11 @@ func TestListPurgeSpaces(t *testing.T) {
 					Space: &resource.Space{
 						GUID: "space-guid",
 					},
+					Stage: &NotifyStage{
+						Name:            "notify",
+						DaysBeforePurge: 5,
+						Template:        defaultNotifyTemplate,
+					},
 				},
 			},
 		},
@@ -335,6 +341,147 @@ func TestListPurgeSpaces(t *testing.T) {
 					Space: &resource.Space{
 						GUID: "space-guid",
 					},
+					Stage: &NotifyStage{
+						Name:            "notify",
+						DaysBeforePurge: 5,
+						Template:        defaultNotifyTemplate,
+					},
+				},
+			},
+		},
+		"notifies on a configured reminder stage": {
+			spaces: []*resource.Space{
+				{GUID: "space-guid"},
+			},
+			now: now.Truncate(24 * time.Hour),
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-28 * 24 * time.Hour),
+				},
+			},
+			opts: Options{
+				PurgeDays:         30,
+				NotifyStageDays:   []int{1, 7, 2},
+				NotifyMailSubject: "reminder",
+			},
+			expectedToNotify: []SpaceDetails{
+				{
+					Timestamp: now.Add(-28 * 24 * time.Hour).Truncate(24 * time.Hour),
+					Space: &resource.Space{
+						GUID: "space-guid",
+					},
+					Stage: &NotifyStage{
+						Name:            "2-days",
+						DaysBeforePurge: 2,
+						Subject:         "reminder",
+						Template:        defaultNotifyTemplate,
+					},
+				},
+			},
+		},
+		"notifies on the final reminder stage": {
+			spaces: []*resource.Space{
+				{GUID: "space-guid"},
+			},
+			now: now.Truncate(24 * time.Hour),
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-29 * 24 * time.Hour),
+				},
+			},
+			opts: Options{
+				PurgeDays:              30,
+				NotifyStageDays:        []int{7, 2, 1},
+				NotifyMailSubject:      "reminder",
+				FinalNotifyMailSubject: "final warning",
+			},
+			expectedToNotify: []SpaceDetails{
+				{
+					Timestamp: now.Add(-29 * 24 * time.Hour).Truncate(24 * time.Hour),
+					Space: &resource.Space{
+						GUID: "space-guid",
+					},
+					Stage: &NotifyStage{
+						Name:            "final",
+						DaysBeforePurge: 1,
+						Subject:         "final warning",
+						Template:        finalNotifyTemplate,
+					},
+				},
+			},
+		},
+		"does not notify before the first configured reminder stage": {
+			spaces: []*resource.Space{
+				{GUID: "space-guid"},
+			},
+			now: now.Truncate(24 * time.Hour),
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-22 * 24 * time.Hour),
+				},
+			},
+			opts: Options{
+				PurgeDays:       30,
+				NotifyStageDays: []int{7, 2, 1},
+			},
+		},
+		"notifies on the current stage after a missed run": {
+			spaces: []*resource.Space{
+				{GUID: "space-guid"},
+			},
+			now: now.Truncate(24 * time.Hour),
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-26 * 24 * time.Hour),
+				},
+			},
+			opts: Options{
+				PurgeDays:       30,
+				NotifyStageDays: []int{7, 2, 1},
+			},
+			expectedToNotify: []SpaceDetails{
+				{
+					Timestamp: now.Add(-26 * 24 * time.Hour).Truncate(24 * time.Hour),
+					Space: &resource.Space{
+						GUID: "space-guid",
+					},
+					Stage: &NotifyStage{
+						Name:            "7-days",
+						DaysBeforePurge: 7,
+						Template:        defaultNotifyTemplate,
+					},
 				},
 			},
 		},
@@ -488,6 +635,11 @@ func TestListPurgeSpaces(t *testing.T) {
 					Space: &resource.Space{
 						GUID: "space-guid",
 					},
+					Stage: &NotifyStage{
+						Name:            "notify",
+						DaysBeforePurge: 5,
+						Template:        defaultNotifyTemplate,
+					},
 				},
 			},
 		},
@@ -516,13 +668,133 @@ func TestListPurgeSpaces(t *testing.T) {
 			},
 			timeStartsAt: time.Time{},
 		},
+		"skips spaces exempted by space annotation": {
+			spaces: []*resource.Space{
+				{
+					GUID: "space-guid",
+					Metadata: resource.NewMetadata().
+						WithAnnotation("", exemptUntilKey, now.Add(2*24*time.Hour).Format(exemptDateLayout)).
+						WithAnnotation("", exemptReasonKey, "agency demo"),
+				},
+			},
+			now: now.Truncate(24 * time.Hour),
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-31 * 24 * time.Hour),
+				},
+			},
+			opts: Options{
+				NotifyDays: 25,
+				PurgeDays:  30,
+			},
+		},
+		"skips spaces exempted by org label": {
+			org: &resource.Organization{
+				Metadata: resource.NewMetadata().
+					WithLabel("", exemptUntilKey, now.Format(exemptDateLayout)),
+			},
+			spaces: []*resource.Space{
+				{GUID: "space-guid"},
+			},
+			now: now.Truncate(24 * time.Hour),
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-31 * 24 * time.Hour),
+				},
+			},
+			opts: Options{
+				NotifyDays: 25,
+				PurgeDays:  30,
+			},
+		},
+		"skips spaces with invalid exemption": {
+			spaces: []*resource.Space{
+				{
+					GUID:     "space-guid",
+					Metadata: resource.NewMetadata().WithAnnotation("", exemptUntilKey, "next tuesday"),
+				},
+			},
+			now: now.Truncate(24 * time.Hour),
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-31 * 24 * time.Hour),
+				},
+			},
+			opts: Options{
+				NotifyDays: 25,
+				PurgeDays:  30,
+			},
+		},
+		"purges spaces with expired exemption": {
+			spaces: []*resource.Space{
+				{
+					GUID:     "space-guid",
+					Metadata: resource.NewMetadata().WithAnnotation("", exemptUntilKey, now.Add(-2*24*time.Hour).Format(exemptDateLayout)),
+				},
+			},
+			now: now.Truncate(24 * time.Hour),
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-31 * 24 * time.Hour),
+				},
+			},
+			opts: Options{
+				NotifyDays: 25,
+				PurgeDays:  30,
+			},
+			expectedToPurge: []SpaceDetails{
+				{
+					Timestamp: now.Add(-31 * 24 * time.Hour).Truncate(24 * time.Hour),
+					Space: &resource.Space{
+						GUID:     "space-guid",
+						Metadata: resource.NewMetadata().WithAnnotation("", exemptUntilKey, now.Add(-2*24*time.Hour).Format(exemptDateLayout)),
+					},
+				},
+			},
+		},
 	}
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
 			toNotify, toPurge, err := listPurgeSpaces(
-				test.spaces,
-				test.apps,
-				test.instances,
+				context.Background(),
+				test.org,
+				orgResources{
+					Spaces:    test.spaces,
+					Apps:      test.apps,
+					Instances: test.instances,
+				},
 				test.opts,
 				test.now,
 				test.timeStartsAt,
@@ -546,6 +818,10 @@ func TestGetFirstResource(t *testing.T) {
 		space                 *resource.Space
 		apps                  []*resource.App
 		instances             []*resource.ServiceInstance
+		routes                []*resource.Route
+		bindings              []*resource.ServiceCredentialBinding
+		events                []*resource.AuditEvent
+		types                 []string
 		expectedFirstResource time.Time
 		expectedErr           string
 	}{
@@ -618,13 +894,197 @@ func TestGetFirstResource(t *testing.T) {
 			},
 			expectedFirstResource: now.Add(-10 * 24 * time.Hour),
 		},
+		"returns the timestamp of a space with only routes": {
+			space: &resource.Space{
+				GUID: "space-guid",
+			},
+			routes: []*resource.Route{
+				{
+					GUID: "route-guid",
+					Relationships: resource.RouteRelationships{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-10 * 24 * time.Hour),
+				},
+			},
+			expectedFirstResource: now.Add(-10 * 24 * time.Hour),
+		},
+		"returns the timestamp of a service key in the instance space": {
+			space: &resource.Space{
+				GUID: "space-guid",
+			},
+			instances: []*resource.ServiceInstance{
+				{
+					GUID: "instance-guid",
+					Relationships: resource.ServiceInstanceRelationships{
+						Space: &resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-5 * 24 * time.Hour),
+				},
+			},
+			bindings: []*resource.ServiceCredentialBinding{
+				{
+					GUID: "key-guid",
+					Type: "key",
+					Relationships: resource.ServiceCredentialBindingRelationships{
+						ServiceInstance: &resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "instance-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-10 * 24 * time.Hour),
+				},
+			},
+			expectedFirstResource: now.Add(-10 * 24 * time.Hour),
+		},
+		"skips resource types that are not included": {
+			space: &resource.Space{
+				GUID: "space-guid",
+			},
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-5 * 24 * time.Hour),
+				},
+			},
+			routes: []*resource.Route{
+				{
+					GUID: "route-guid",
+					Relationships: resource.RouteRelationships{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-10 * 24 * time.Hour),
+				},
+			},
+			types:                 []string{resourceTypeApps, resourceTypeServiceInstances},
+			expectedFirstResource: now.Add(-5 * 24 * time.Hour),
+		},
+		"returns the timestamp of a create event for a deleted app": {
+			space: &resource.Space{
+				GUID:      "space-guid",
+				CreatedAt: now.Add(-60 * 24 * time.Hour),
+			},
+			apps: []*resource.App{
+				{
+					GUID: "app-guid",
+					Relationships: resource.SpaceRelationship{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-2 * 24 * time.Hour),
+				},
+			},
+			events: []*resource.AuditEvent{
+				{
+					Type:      "audit.app.create",
+					Target:    resource.AuditEventRelatedObject{GUID: "deleted-app-guid", Name: "app"},
+					Space:     resource.Relationship{GUID: "space-guid"},
+					CreatedAt: now.Add(-20 * 24 * time.Hour),
+				},
+				{
+					Type:      "audit.app.create",
+					Target:    resource.AuditEventRelatedObject{GUID: "other-app-guid", Name: "app"},
+					Space:     resource.Relationship{GUID: "other-space-guid"},
+					CreatedAt: now.Add(-40 * 24 * time.Hour),
+				},
+			},
+			expectedFirstResource: now.Add(-20 * 24 * time.Hour),
+		},
+		"skips create events from before the space was created": {
+			space: &resource.Space{
+				GUID:      "space-guid",
+				CreatedAt: now.Add(-10 * 24 * time.Hour),
+			},
+			routes: []*resource.Route{
+				{
+					GUID: "route-guid",
+					Relationships: resource.RouteRelationships{
+						Space: resource.ToOneRelationship{
+							Data: &resource.Relationship{
+								GUID: "space-guid",
+							},
+						},
+					},
+					CreatedAt: now.Add(-3 * 24 * time.Hour),
+				},
+			},
+			events: []*resource.AuditEvent{
+				{
+					Type:      "audit.route.create",
+					Space:     resource.Relationship{GUID: "space-guid"},
+					CreatedAt: now.Add(-20 * 24 * time.Hour),
+				},
+				{
+					Type:      "audit.route.create",
+					Space:     resource.Relationship{GUID: "space-guid"},
+					CreatedAt: now.Add(-5 * 24 * time.Hour),
+				},
+			},
+			expectedFirstResource: now.Add(-5 * 24 * time.Hour),
+		},
+		"skips a space whose resources were all deleted": {
+			space: &resource.Space{
+				GUID:      "space-guid",
+				CreatedAt: now.Add(-60 * 24 * time.Hour),
+			},
+			events: []*resource.AuditEvent{
+				{
+					Type:      "audit.app.create",
+					Target:    resource.AuditEventRelatedObject{GUID: "deleted-app-guid", Name: "app"},
+					Space:     resource.Relationship{GUID: "space-guid"},
+					CreatedAt: now.Add(-40 * 24 * time.Hour),
+				},
+			},
+		},
+		"skips create events for resource types that are not included": {
+			space: &resource.Space{
+				GUID: "space-guid",
+			},
+			events: []*resource.AuditEvent{
+				{
+					Type:      "audit.route.create",
+					Space:     resource.Relationship{GUID: "space-guid"},
+					CreatedAt: now.Add(-20 * 24 * time.Hour),
+				},
+			},
+			types: []string{resourceTypeApps},
+		},
 	}
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
 			firstResource, err := letFirstResource(
 				test.space,
-				test.apps,
-				test.instances,
+				orgResources{
+					Apps:               test.apps,
+					Instances:          test.instances,
+					Routes:             test.routes,
+					CredentialBindings: test.bindings,
+					CreateEvents:       test.events,
+				},
+				test.types,
 			)
 			if (test.expectedErr == "" && err != nil) || (test.expectedErr != "" && test.expectedErr != err.Error()) {
 				t.Fatalf("expected error: %s, got: %s", test.expectedErr, err)
@@ -636,6 +1096,44 @@ func TestGetFirstResource(t *testing.T) {
 	}
 }
 
+func TestGroupResourcesBySpace(t *testing.T) {
+	now := time.Now()
+	inSpace := func(guid string) resource.SpaceRelationship {
+		return resource.SpaceRelationship{Space: resource.ToOneRelationship{Data: &resource.Relationship{GUID: guid}}}
+	}
+	resources := orgResources{
+		Spaces: []*resource.Space{{GUID: "space-1"}, {GUID: "space-2"}},
+		Apps: []*resource.App{
+			{GUID: "app-1", Name: "app-1", Relationships: inSpace("space-1"), CreatedAt: now},
+			{GUID: "app-2", Name: "app-2", Relationships: inSpace("space-2"), CreatedAt: now},
+		},
+		Routes: []*resource.Route{
+			{GUID: "route-1", URL: "route-1.example.gov", Relationships: resource.RouteRelationships{Space: resource.ToOneRelationship{Data: &resource.Relationship{GUID: "space-1"}}}, CreatedAt: now},
+		},
+	}
+
+	resources.CreateEvents = []*resource.AuditEvent{
+		{
+			Type:      "audit.app.create",
+			Target:    resource.AuditEventRelatedObject{GUID: "deleted-app", Name: "deleted-app"},
+			Space:     resource.Relationship{GUID: "space-2"},
+			CreatedAt: now,
+		},
+	}
+
+	expected := map[string][]spaceResource{
+		"space-1": {{Type: resourceTypeApps, GUID: "app-1", Name: "app-1", CreatedAt: now}},
+		"space-2": {
+			{Type: resourceTypeApps, GUID: "app-2", Name: "app-2", CreatedAt: now},
+			{Type: resourceTypeApps, GUID: "deleted-app", Name: "deleted-app", CreatedAt: now, AuditEvent: true},
+		},
+	}
+	got := groupResourcesBySpace(resources, []string{resourceTypeApps, resourceTypeServiceInstances})
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("unexpected resources (-expected +got):\n%s", diff)
+	}
+}
+
 func TestPurgeSpace(t *testing.T) {
 	deleteSpaceErr := errors.New("delete space error")
 	listAppsErr := errors.New("error listing applications")
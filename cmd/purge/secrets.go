@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// secretOption is a secret that can be set directly or read from a file, e.g.
+// CLIENT_SECRET or CLIENT_SECRET_FILE
+type secretOption struct {
+	env   string
+	file  string
+	value *string
+}
+
+func listSecretOptions(opts *Options) []secretOption {
+	return []secretOption{
+		{env: "CLIENT_SECRET", file: opts.ClientSecretFile, value: &opts.ClientSecret},
+		{env: "SMTP_PASS", file: opts.SMTPPassFile, value: &opts.SMTPPass},
+		{env: "SMTP_CERT", file: opts.SMTPCertFile, value: &opts.SMTPCert},
+	}
+}
+
+// checkSecretSources reports secrets set both directly and from a file
+func checkSecretSources(opts Options) error {
+	var problems []error
+	for _, secret := range listSecretOptions(&opts) {
+		if secret.file != "" && *secret.value != "" {
+			problems = append(problems, fmt.Errorf("set only one of %s and %s_FILE", secret.env, secret.env))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// readSecretFiles sets each secret whose _FILE variant is set from that file,
+// leaving out trailing newlines
+func readSecretFiles(opts *Options) error {
+	var problems []error
+	for _, secret := range listSecretOptions(opts) {
+		if secret.file == "" {
+			continue
+		}
+		contents, err := os.ReadFile(secret.file)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("error reading %s_FILE: %w", secret.env, err))
+			continue
+		}
+		*secret.value = strings.TrimRight(string(contents), "\r\n")
+	}
+	return errors.Join(problems...)
+}
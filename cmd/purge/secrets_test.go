@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, contents string) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(contents), 0o600); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return filename
+	}
+	secretFile := writeFile("client-secret", "secret\n")
+	certFile := writeFile("smtp-cert", "-----BEGIN CERTIFICATE-----\nabc\n-----END CERTIFICATE-----\n")
+
+	testCases := map[string]struct {
+		opts           Options
+		expected       Options
+		expectedErrors []string
+	}{
+		"from files": {
+			opts: Options{
+				ClientSecretFile: secretFile,
+				SMTPOptions:      SMTPOptions{SMTPPass: "pass", SMTPCertFile: certFile},
+			},
+			expected: Options{
+				ClientSecret:     "secret",
+				ClientSecretFile: secretFile,
+				SMTPOptions: SMTPOptions{
+					SMTPPass:     "pass",
+					SMTPCert:     "-----BEGIN CERTIFICATE-----\nabc\n-----END CERTIFICATE-----",
+					SMTPCertFile: certFile,
+				},
+			},
+		},
+		"missing file": {
+			opts: Options{
+				SMTPOptions: SMTPOptions{SMTPPassFile: filepath.Join(dir, "missing")},
+			},
+			expected: Options{
+				SMTPOptions: SMTPOptions{SMTPPassFile: filepath.Join(dir, "missing")},
+			},
+			expectedErrors: []string{"error reading SMTP_PASS_FILE"},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			opts := test.opts
+			err := readSecretFiles(&opts)
+			checkProblems(t, err, test.expectedErrors)
+			if diff := cmp.Diff(test.expected, opts); diff != "" {
+				t.Errorf("unexpected options (-expected +got):\n%s", diff)
+			}
+		})
+	}
+
+	err := checkSecretSources(Options{ClientSecret: "secret", ClientSecretFile: secretFile})
+	checkProblems(t, err, []string{"set only one of CLIENT_SECRET and CLIENT_SECRET_FILE"})
+}
+
+func TestReloadSecrets(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "client-secret")
+	if err := os.WriteFile(filename, []byte("first"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var built []string
+	r := &runner{
+		opts: Options{ClientSecret: "first", ClientSecretFile: filename},
+		newClient: func(opts Options) (*cfResourceClient, error) {
+			built = append(built, opts.ClientSecret)
+			return &cfResourceClient{}, nil
+		},
+	}
+
+	if err := r.reloadSecrets(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := r.reloadSecrets(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff([]string{"first"}, built); diff != "" {
+		t.Errorf("expected client to be built once and reused while the secret is unchanged (-expected +got):\n%s", diff)
+	}
+
+	if err := os.WriteFile(filename, []byte("second\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := r.reloadSecrets(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff([]string{"first", "second"}, built); diff != "" {
+		t.Errorf("unexpected clients built (-expected +got):\n%s", diff)
+	}
+	if r.opts.ClientSecret != "second" || r.cfClient == nil {
+		t.Errorf("expected runner to use the rotated secret")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron/v3"
+)
+
+// scheduledCommand is a command serve runs on a cron schedule
+type scheduledCommand struct {
+	command  string
+	schedule cron.Schedule
+}
+
+// parseSchedules parses NOTIFY_SCHEDULE and PURGE_SCHEDULE as standard
+// five-field cron expressions, leaving out any that aren't set
+func parseSchedules(opts Options) ([]scheduledCommand, error) {
+	var schedules []scheduledCommand
+	for _, s := range []struct {
+		command string
+		env     string
+		spec    string
+	}{
+		{command: commandNotify, env: "NOTIFY_SCHEDULE", spec: opts.NotifySchedule},
+		{command: commandPurge, env: "PURGE_SCHEDULE", spec: opts.PurgeSchedule},
+	} {
+		if s.spec == "" {
+			continue
+		}
+		schedule, err := cron.ParseStandard(s.spec)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s %q: %w", s.env, s.spec, err)
+		}
+		schedules = append(schedules, scheduledCommand{command: s.command, schedule: schedule})
+	}
+	return schedules, nil
+}
+
+// nextRun returns the schedule that fires first after a time; on a tie the
+// earlier schedule wins, so notify runs before purge
+func nextRun(schedules []scheduledCommand, after time.Time) (scheduledCommand, time.Time) {
+	var first scheduledCommand
+	var firstAt time.Time
+	for _, s := range schedules {
+		at := s.schedule.Next(after)
+		if firstAt.IsZero() || at.Before(firstAt) {
+			first, firstAt = s, at
+		}
+	}
+	return first, firstAt
+}
+
+// runStatus describes a scheduled run; with several foundations, each has
+// its own summary or error
+type runStatus struct {
+	Command     string          `json:"command"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	Summary     *runSummary     `json:"summary,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Foundations []foundationRun `json:"foundations,omitempty"`
+}
+
+// serveStatus tracks the current, last and next runs for /status
+type serveStatus struct {
+	mu          sync.Mutex
+	Current     *runStatus `json:"current,omitempty"`
+	LastRun     *runStatus `json:"last_run,omitempty"`
+	NextCommand string     `json:"next_command,omitempty"`
+	NextRunAt   *time.Time `json:"next_run_at,omitempty"`
+}
+
+func (s *serveStatus) setNext(command string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.NextCommand, s.NextRunAt = command, &at
+}
+
+func (s *serveStatus) start(command string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Current = &runStatus{Command: command, StartedAt: now}
+}
+
+func (s *serveStatus) finish(runs []foundationRun, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := s.Current
+	if run == nil {
+		return
+	}
+	run.FinishedAt = &now
+	if len(runs) == 1 && runs[0].Foundation == "" {
+		run.Summary, run.Error = runs[0].Summary, runs[0].Error
+	} else {
+		run.Foundations = runs
+	}
+	s.Current, s.LastRun = nil, run
+}
+
+func (s *serveStatus) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// newServeMux serves /healthz for the platform's health check, /status for
+// operators and /metrics for Prometheus
+func newServeMux(status *serveStatus, registry *prometheus.Registry) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.Handle("/status", status)
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+// serve runs notify and purge on every foundation on their schedules until
+// ctx is cancelled; a run in progress stops between spaces and serve then
+// returns
+func serve(ctx context.Context, opts Options, runners []*runner, registry *prometheus.Registry) error {
+	schedules, err := parseSchedules(opts)
+	if err != nil {
+		return err
+	}
+	if len(schedules) == 0 {
+		return errors.New("serve requires NOTIFY_SCHEDULE or PURGE_SCHEDULE")
+	}
+
+	status := &serveStatus{}
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", opts.Port),
+		Handler:           newServeMux(status, registry),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+	slog.InfoContext(ctx, "serving /healthz, /status and /metrics", "addr", server.Addr)
+
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.ErrorContext(ctx, "error shutting down server", "error", err)
+		}
+	}()
+
+	for {
+		scheduled, at := nextRun(schedules, time.Now())
+		status.setNext(scheduled.command, at)
+		slog.InfoContext(ctx, "scheduled next run", "command", scheduled.command, "at", at)
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.InfoContext(ctx, "stopping")
+			return nil
+		case err := <-serveErr:
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		slog.InfoContext(ctx, "starting scheduled run", "command", scheduled.command)
+		status.start(scheduled.command, time.Now())
+		runs := runFoundations(ctx, runners, cliCommand{Name: scheduled.command})
+		status.finish(runs, time.Now())
+		logFoundationRuns(withLogAttrs(ctx, "command", scheduled.command), runs)
+	}
+}
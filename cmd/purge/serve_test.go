@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNextRun(t *testing.T) {
+	schedules, err := parseSchedules(Options{
+		NotifySchedule: "0 14 * * *",
+		PurgeSchedule:  "0 14 * * 1-5",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	testCases := map[string]struct {
+		after           time.Time
+		expectedCommand string
+		expectedAt      time.Time
+	}{
+		"notify wins a tie": {
+			after:           time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			expectedCommand: commandNotify,
+			expectedAt:      time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC),
+		},
+		"purge runs on weekdays only": {
+			after:           time.Date(2024, 5, 4, 15, 0, 0, 0, time.UTC),
+			expectedCommand: commandNotify,
+			expectedAt:      time.Date(2024, 5, 5, 14, 0, 0, 0, time.UTC),
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			scheduled, at := nextRun(schedules, test.after)
+			if scheduled.command != test.expectedCommand {
+				t.Errorf("expected command %s, got %s", test.expectedCommand, scheduled.command)
+			}
+			if !at.Equal(test.expectedAt) {
+				t.Errorf("expected run at %s, got %s", test.expectedAt, at)
+			}
+		})
+	}
+
+	if _, err := parseSchedules(Options{PurgeSchedule: "every day"}); err == nil {
+		t.Errorf("expected error for invalid schedule")
+	}
+}
+
+func TestServeStatusFoundations(t *testing.T) {
+	status := &serveStatus{}
+	started := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	status.start(commandNotify, started)
+	runs := []foundationRun{
+		{Foundation: "east", Error: "error getting orgs: connection refused"},
+		{Foundation: "west", Summary: &runSummary{Succeeded: 1, Failures: []runFailure{}}},
+	}
+	status.finish(runs, started.Add(time.Minute))
+
+	if status.LastRun.Summary != nil || status.LastRun.Error != "" {
+		t.Errorf("expected no combined summary, got %+v", status.LastRun)
+	}
+	if diff := cmp.Diff(runs, status.LastRun.Foundations); diff != "" {
+		t.Errorf("foundations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServeStatus(t *testing.T) {
+	status := &serveStatus{}
+	started := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	finished := started.Add(time.Minute)
+	status.start(commandPurge, started)
+	status.finish([]foundationRun{{Summary: &runSummary{Succeeded: 2, Failures: []runFailure{}}, Error: "boom"}}, finished)
+	status.setNext(commandNotify, started.Add(24*time.Hour))
+
+	mux := newServeMux(status, newRunMetrics().registry)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != 200 {
+		t.Errorf("expected /healthz to return 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	var got serveStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	nextRunAt := started.Add(24 * time.Hour)
+	expected := serveStatus{
+		LastRun: &runStatus{
+			Command:    commandPurge,
+			StartedAt:  started,
+			FinishedAt: &finished,
+			Summary:    &runSummary{Succeeded: 2, Failures: []runFailure{}},
+			Error:      "boom",
+		},
+		NextCommand: commandNotify,
+		NextRunAt:   &nextRunAt,
+	}
+	if diff := cmp.Diff(&expected, &got, cmpopts.IgnoreUnexported(serveStatus{})); diff != "" {
+		t.Errorf("status mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+)
+
+// purgeSnapshot records what's needed to recreate a space if a run dies
+// between deleting the space and restoring its roles
+type purgeSnapshot struct {
+	CreatedAt          time.Time              `json:"created_at"`
+	Org                *resource.Organization `json:"org"`
+	Space              *resource.Space        `json:"space"`
+	Developers         []spaceUser            `json:"developers"`
+	Managers           []spaceUser            `json:"managers"`
+	DeleteJobGUID      string                 `json:"delete_job_guid,omitempty"`
+	RecreatedSpaceGUID string                 `json:"recreated_space_guid,omitempty"`
+}
+
+// snapshotStore saves one snapshot file per space being purged; snapshots
+// list usernames, so they are encrypted when the cipher has recipients
+type snapshotStore struct {
+	dir    string
+	cipher *artifactCipher
+}
+
+// newSnapshotStore creates the snapshot directory if needed
+func newSnapshotStore(dir string, cipher *artifactCipher) (*snapshotStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating snapshot directory %s: %w", dir, err)
+	}
+	return &snapshotStore{dir: dir, cipher: cipher}, nil
+}
+
+func (s *snapshotStore) filename(spaceGUID string) string {
+	return filepath.Join(s.dir, spaceGUID+".json")
+}
+
+// save writes a snapshot to a temporary file and renames it into place, so
+// an interrupted run never leaves a partial snapshot
+func (s *snapshotStore) save(snapshot *purgeSnapshot) error {
+	if s == nil {
+		return nil
+	}
+	contents, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	contents, err = s.cipher.encrypt(contents)
+	if err != nil {
+		return fmt.Errorf("error encrypting snapshot: %w", err)
+	}
+	filename := s.filename(snapshot.Space.GUID)
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// remove deletes the snapshot for a space once it is fully recreated
+func (s *snapshotStore) remove(spaceGUID string) error {
+	if s == nil {
+		return nil
+	}
+	err := os.Remove(s.filename(spaceGUID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// list reads every saved snapshot, oldest first
+func (s *snapshotStore) list() ([]*purgeSnapshot, error) {
+	if s == nil {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot directory %s: %w", s.dir, err)
+	}
+
+	var snapshots []*purgeSnapshot
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		contents, err = s.cipher.decrypt(contents)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting snapshot %s: %w", entry.Name(), err)
+		}
+		var snapshot purgeSnapshot
+		if err := json.Unmarshal(contents, &snapshot); err != nil {
+			return nil, fmt.Errorf("error parsing snapshot %s: %w", entry.Name(), err)
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// recoverPurges finishes recreating spaces and roles for purges that were
+// interrupted; spaces that still exist are left for a later run
+func recoverPurges(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	policy *Policy,
+	snapshots *snapshotStore,
+	ledger *notifyLedger,
+) error {
+	pending, err := snapshots.list()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, snapshot := range pending {
+		orgOpts, _ := policy.orgOptions(opts, snapshot.Org.Name)
+		ctx := withLogAttrs(ctx, "org", snapshot.Org.Name, "space_guid", snapshot.Space.GUID)
+		if err := recoverPurge(ctx, cfClient, orgOpts, snapshot, snapshots, ledger); err != nil {
+			errs = append(errs, fmt.Errorf("error recovering space %s in org %s: %w", snapshot.Space.Name, snapshot.Org.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func recoverPurge(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	opts Options,
+	snapshot *purgeSnapshot,
+	snapshots *snapshotStore,
+	ledger *notifyLedger,
+) error {
+	if snapshot.RecreatedSpaceGUID == "" && snapshot.DeleteJobGUID != "" {
+		job, err := cfClient.Jobs.Get(ctx, snapshot.DeleteJobGUID)
+		if err != nil {
+			return fmt.Errorf("error checking delete job %s: %w", snapshot.DeleteJobGUID, err)
+		}
+		switch job.State {
+		case resource.JobStateFailed:
+			// The space wasn't deleted, so a later run can purge it again
+			if err := snapshots.remove(snapshot.Space.GUID); err != nil {
+				return err
+			}
+			return fmt.Errorf("delete job %s failed: %v", job.GUID, job.Errors)
+		case resource.JobStateComplete:
+		default:
+			slog.InfoContext(ctx, "delete job is still running; checking again next run", "space", snapshot.Space.Name, "job_guid", job.GUID, "state", job.State)
+			return nil
+		}
+	}
+
+	if snapshot.RecreatedSpaceGUID == "" {
+		original, err := findSpace(ctx, cfClient, snapshot.Org, func(listOpts *client.SpaceListOptions) {
+			listOpts.GUIDs.EqualTo(snapshot.Space.GUID)
+		})
+		if err != nil {
+			return err
+		}
+		if original != nil {
+			slog.InfoContext(ctx, "space has not been deleted yet; leaving its snapshot for a later run", "space", snapshot.Space.Name)
+			return nil
+		}
+
+		recreated, err := findSpace(ctx, cfClient, snapshot.Org, func(listOpts *client.SpaceListOptions) {
+			listOpts.Names.EqualTo(snapshot.Space.Name)
+		})
+		if err != nil {
+			return err
+		}
+		if recreated == nil {
+			slog.InfoContext(ctx, "recovering: recreating space", "space", snapshot.Space.Name)
+			recreated, err = recreateSpace(ctx, cfClient, opts, snapshot.Org, SpaceDetails{Space: snapshot.Space})
+			if err != nil {
+				return err
+			}
+		}
+
+		snapshot.RecreatedSpaceGUID = recreated.GUID
+		if err := snapshots.save(snapshot); err != nil {
+			return err
+		}
+	}
+
+	slog.InfoContext(ctx, "recovering: restoring roles", "space", snapshot.Space.Name)
+	if err := recreateMissingSpaceRoles(ctx, cfClient, snapshot.RecreatedSpaceGUID, snapshot.Developers, snapshot.Managers); err != nil {
+		return err
+	}
+	if err := snapshots.remove(snapshot.Space.GUID); err != nil {
+		return err
+	}
+	// The purge is only finished now, so the space's reminders can start over
+	return ledger.forget(snapshot.Space.GUID)
+}
+
+// listDeleting returns the GUIDs of spaces with a delete job started by an
+// earlier run that hasn't been recovered yet
+func (s *snapshotStore) listDeleting() (map[string]bool, error) {
+	pending, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	deleting := map[string]bool{}
+	for _, snapshot := range pending {
+		if snapshot.DeleteJobGUID != "" && snapshot.RecreatedSpaceGUID == "" {
+			deleting[snapshot.Space.GUID] = true
+		}
+	}
+	return deleting, nil
+}
+
+// findSpace returns the space in an org matching a filter, or nil if there
+// isn't one
+func findSpace(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	org *resource.Organization,
+	filter func(*client.SpaceListOptions),
+) (*resource.Space, error) {
+	listOpts := client.NewSpaceListOptions()
+	listOpts.OrganizationGUIDs.EqualTo(org.GUID)
+	filter(listOpts)
+	spaces, err := cfClient.Spaces.ListAll(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	if len(spaces) == 0 {
+		return nil, nil
+	}
+	return spaces[0], nil
+}
+
+// recreateMissingSpaceRoles restores developer and manager roles, skipping
+// roles that were restored before the run was interrupted
+func recreateMissingSpaceRoles(
+	ctx context.Context,
+	cfClient *cfResourceClient,
+	spaceGUID string,
+	developers []spaceUser,
+	managers []spaceUser,
+) error {
+	roleListOpts := client.NewRoleListOptions()
+	roleListOpts.SpaceGUIDs.Values = []string{spaceGUID}
+	existingRoles, _, err := cfClient.Roles.ListIncludeUsersAll(ctx, roleListOpts)
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]bool{}
+	for _, role := range existingRoles {
+		existing[role.Type+"/"+role.Relationships.User.Data.GUID] = true
+	}
+
+	var missingDevelopers, missingManagers []spaceUser
+	for _, developer := range developers {
+		if !existing[resource.SpaceRoleDeveloper.String()+"/"+developer.GUID] {
+			missingDevelopers = append(missingDevelopers, developer)
+		}
+	}
+	for _, manager := range managers {
+		if !existing[resource.SpaceRoleManager.String()+"/"+manager.GUID] {
+			missingManagers = append(missingManagers, manager)
+		}
+	}
+	return recreateSpaceDevsAndManagers(ctx, cfClient, spaceGUID, missingDevelopers, missingManagers)
+}
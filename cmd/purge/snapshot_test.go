@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/client"
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestSnapshot() *purgeSnapshot {
+	return &purgeSnapshot{
+		CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Org:       &resource.Organization{GUID: "org-1", Name: "sandbox-org"},
+		Space: &resource.Space{
+			GUID: "space-1-guid",
+			Name: "space-1",
+			Relationships: &resource.SpaceRelationships{
+				Organization: &resource.ToOneRelationship{
+					Data: &resource.Relationship{GUID: "org-1"},
+				},
+			},
+		},
+		Developers: []spaceUser{{GUID: "user-2", Username: "foo2@bar.gov"}},
+		Managers:   []spaceUser{{GUID: "user-1", Username: "foo@bar.gov"}},
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	snapshots, err := newSnapshotStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	snapshot := newTestSnapshot()
+	if err := snapshots.save(snapshot); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	saved, err := snapshots.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff([]*purgeSnapshot{snapshot}, saved); diff != "" {
+		t.Errorf("snapshots mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := snapshots.remove(snapshot.Space.GUID); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	saved, err = snapshots.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(saved) != 0 {
+		t.Errorf("expected no snapshots after remove, got %d", len(saved))
+	}
+}
+
+func TestRecoverPurge(t *testing.T) {
+	newRole := func(roleType resource.SpaceRoleType, userGUID string) *resource.Role {
+		return &resource.Role{
+			Type: roleType.String(),
+			Relationships: resource.RoleSpaceUserOrganizationRelationships{
+				User: resource.ToOneRelationship{
+					Data: &resource.Relationship{GUID: userGUID},
+				},
+			},
+		}
+	}
+	newSpace := &resource.Space{GUID: "new-space-1-guid", Name: "space-1"}
+
+	testCases := map[string]struct {
+		existingSpaces       []*resource.Space
+		recreatedSpaceGUID   string
+		existingRoles        []*resource.Role
+		deleteJob            *resource.Job
+		expectedCreateCalls  int
+		expectedCreatedRoles []spaceCreatedRole
+		expectSnapshotKept   bool
+		expectedErr          bool
+	}{
+		"waits for a delete job that is still running": {
+			existingSpaces:     []*resource.Space{{GUID: "space-1-guid", Name: "space-1"}},
+			deleteJob:          &resource.Job{GUID: "delete-1", State: resource.JobStateProcessing},
+			expectSnapshotKept: true,
+		},
+		"drops the snapshot when the delete job failed": {
+			existingSpaces: []*resource.Space{{GUID: "space-1-guid", Name: "space-1"}},
+			deleteJob:      &resource.Job{GUID: "delete-1", State: resource.JobStateFailed},
+			expectedErr:    true,
+		},
+		"recreates the space once the delete job completes": {
+			deleteJob:           &resource.Job{GUID: "delete-1", State: resource.JobStateComplete},
+			expectedCreateCalls: 1,
+			expectedCreatedRoles: []spaceCreatedRole{
+				{SpaceGUID: "new-space-1-guid", UserGUID: "user-2", RoleType: resource.SpaceRoleDeveloper},
+				{SpaceGUID: "new-space-1-guid", UserGUID: "user-1", RoleType: resource.SpaceRoleManager},
+			},
+		},
+		"leaves spaces that are not deleted yet": {
+			existingSpaces:     []*resource.Space{{GUID: "space-1-guid", Name: "space-1"}},
+			expectSnapshotKept: true,
+		},
+		"recreates deleted space and roles": {
+			expectedCreateCalls: 1,
+			expectedCreatedRoles: []spaceCreatedRole{
+				{SpaceGUID: "new-space-1-guid", UserGUID: "user-2", RoleType: resource.SpaceRoleDeveloper},
+				{SpaceGUID: "new-space-1-guid", UserGUID: "user-1", RoleType: resource.SpaceRoleManager},
+			},
+		},
+		"reuses a space recreated before the crash": {
+			existingSpaces: []*resource.Space{newSpace},
+			expectedCreatedRoles: []spaceCreatedRole{
+				{SpaceGUID: "new-space-1-guid", UserGUID: "user-2", RoleType: resource.SpaceRoleDeveloper},
+				{SpaceGUID: "new-space-1-guid", UserGUID: "user-1", RoleType: resource.SpaceRoleManager},
+			},
+		},
+		"only restores missing roles": {
+			existingSpaces:     []*resource.Space{newSpace},
+			recreatedSpaceGUID: "new-space-1-guid",
+			existingRoles:      []*resource.Role{newRole(resource.SpaceRoleManager, "user-1")},
+			expectedCreatedRoles: []spaceCreatedRole{
+				{SpaceGUID: "new-space-1-guid", UserGUID: "user-2", RoleType: resource.SpaceRoleDeveloper},
+			},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			snapshots, err := newSnapshotStore(t.TempDir(), nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			ledger, err := loadNotifyLedger(filepath.Join(t.TempDir(), "ledger.json"))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			snapshot := newTestSnapshot()
+			if err := ledger.recordNotified(SpaceDetails{Space: snapshot.Space, Stage: &NotifyStage{Name: "notify"}}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			snapshot.RecreatedSpaceGUID = test.recreatedSpaceGUID
+			if test.deleteJob != nil {
+				snapshot.DeleteJobGUID = test.deleteJob.GUID
+			}
+			if err := snapshots.save(snapshot); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			spaces := &mockSpaces{
+				existingSpaces: test.existingSpaces,
+				expectedSpaceCreateRequest: &resource.SpaceCreate{
+					Name:          "space-1",
+					Relationships: snapshot.Space.Relationships,
+				},
+				space: newSpace,
+			}
+			roles := &mockRoles{
+				spaceGUID: "new-space-1-guid",
+				roles:     test.existingRoles,
+			}
+			cfClient := &cfResourceClient{
+				Spaces: spaces,
+				Roles:  roles,
+				Jobs:   &mockJobs{expectedJobGUID: "delete-1", job: test.deleteJob},
+				SpaceQuotas: &mockSpaceQuotas{
+					spaceQuotaName: "quota-1",
+					orgGUID:        "org-1",
+					quota:          &resource.SpaceQuota{GUID: "quota-guid-1"},
+				},
+			}
+
+			err = recoverPurges(context.Background(), cfClient, Options{SandboxQuotaName: "quota-1"}, nil, snapshots, ledger)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %t, got %v", test.expectedErr, err)
+			}
+
+			if spaces.createCallCount != test.expectedCreateCalls {
+				t.Errorf("expected %d space creates, got %d", test.expectedCreateCalls, spaces.createCallCount)
+			}
+			if diff := cmp.Diff(test.expectedCreatedRoles, roles.createdSpaceRoles); diff != "" {
+				t.Errorf("created roles mismatch (-want +got):\n%s", diff)
+			}
+			pending, err := snapshots.list()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if kept := len(pending) > 0; kept != test.expectSnapshotKept {
+				t.Errorf("expected snapshot kept: %t, got %t", test.expectSnapshotKept, kept)
+			}
+			// The ledger entry is only dropped once the purge is finished
+			_, remembered := ledger.Spaces[snapshot.Space.GUID]
+			if expected := test.expectSnapshotKept || test.expectedErr; remembered != expected {
+				t.Errorf("expected ledger entry kept: %t, got %t", expected, remembered)
+			}
+		})
+	}
+}
+
+func TestPurgeDropsSnapshotWhenDeleteFails(t *testing.T) {
+	snapshots, err := newSnapshotStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	snapshot := newTestSnapshot()
+	cfClient := &cfResourceClient{
+		Applications: &mockApplications{},
+		Spaces:       &mockSpaces{deleteErr: errors.New("delete space error")},
+	}
+
+	err = purgeAndRecreateSpace(
+		context.Background(),
+		cfClient,
+		Options{},
+		snapshot.Org,
+		SpaceDetails{Space: snapshot.Space},
+		spaceMembers{Developers: snapshot.Developers, Managers: snapshot.Managers},
+		snapshots,
+		nil,
+		&mockMailSender{},
+	)
+	var stageErr *purgeStageError
+	if !errors.As(err, &stageErr) || stageErr.stage != purgeStageDelete {
+		t.Fatalf("expected delete error, got %v", err)
+	}
+
+	pending, err := snapshots.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected snapshot to be dropped when the space wasn't deleted, got %d", len(pending))
+	}
+}
+
+func TestPurgeLeavesSnapshotWhenDeleteIsPending(t *testing.T) {
+	snapshots, err := newSnapshotStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	snapshot := newTestSnapshot()
+	cfClient := &cfResourceClient{
+		Applications: &mockApplications{},
+		Spaces:       &mockSpaces{deleteJobGUID: "delete-1"},
+		Jobs:         &mockJobs{expectedJobGUID: "delete-1", pollErr: client.AsyncProcessTimeoutError},
+	}
+
+	err = purgeAndRecreateSpace(
+		context.Background(),
+		cfClient,
+		Options{DeleteAsync: true},
+		snapshot.Org,
+		SpaceDetails{Space: snapshot.Space},
+		spaceMembers{Developers: snapshot.Developers, Managers: snapshot.Managers},
+		snapshots,
+		nil,
+		&mockMailSender{},
+	)
+	if !errors.Is(err, ErrSpaceDeletePending) {
+		t.Fatalf("expected pending delete, got %v", err)
+	}
+
+	pending, err := snapshots.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pending) != 1 || pending[0].DeleteJobGUID != "delete-1" {
+		t.Errorf("expected snapshot with the delete job to be kept, got %+v", pending)
+	}
+}
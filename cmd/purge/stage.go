@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	defaultNotifyTemplate = "notify.tmpl"
+	finalNotifyTemplate   = "notify-final.tmpl"
+)
+
+// NotifyStage describes a reminder sent a number of days before a purge
+type NotifyStage struct {
+	Name            string `yaml:"name" json:"name"`
+	DaysBeforePurge int    `yaml:"days_before_purge" json:"days_before_purge"`
+	Subject         string `yaml:"subject" json:"subject"`
+	Template        string `yaml:"template" json:"template"`
+}
+
+// listNotifyStages returns the reminder stages for an org, ordered from the
+// first reminder to the last
+//
+// Stages come from the policy file if set, then from NOTIFY_STAGES; otherwise
+// a single stage is sent NOTIFY_DAYS after the first resource was created.
+func listNotifyStages(opts Options) []NotifyStage {
+	var stages []NotifyStage
+
+	switch {
+	case len(opts.NotifyStages) > 0:
+		for _, stage := range opts.NotifyStages {
+			if stage.Name == "" {
+				stage.Name = fmt.Sprintf("%d-days", stage.DaysBeforePurge)
+			}
+			if stage.Subject == "" {
+				stage.Subject = opts.NotifyMailSubject
+			}
+			if stage.Template == "" {
+				stage.Template = defaultNotifyTemplate
+			}
+			stages = append(stages, stage)
+		}
+	case len(opts.NotifyStageDays) > 0:
+		for _, days := range opts.NotifyStageDays {
+			stages = append(stages, NotifyStage{
+				Name:            fmt.Sprintf("%d-days", days),
+				DaysBeforePurge: days,
+				Subject:         opts.NotifyMailSubject,
+				Template:        defaultNotifyTemplate,
+			})
+		}
+	default:
+		return []NotifyStage{{
+			Name:            "notify",
+			DaysBeforePurge: opts.PurgeDays - opts.NotifyDays,
+			Subject:         opts.NotifyMailSubject,
+			Template:        defaultNotifyTemplate,
+		}}
+	}
+
+	sort.SliceStable(stages, func(i, j int) bool {
+		return stages[i].DaysBeforePurge > stages[j].DaysBeforePurge
+	})
+
+	// With NOTIFY_STAGES, the last of several reminders is the final warning
+	if len(opts.NotifyStages) == 0 && len(stages) > 1 {
+		final := &stages[len(stages)-1]
+		final.Name = "final"
+		final.Template = finalNotifyTemplate
+		if opts.FinalNotifyMailSubject != "" {
+			final.Subject = opts.FinalNotifyMailSubject
+		}
+	}
+
+	return stages
+}
+
+// getCurrentNotifyStage returns the latest stage reached with daysLeft days
+// remaining before purge, so that a missed run still sends the stage; the
+// ledger keeps a stage from being sent again on later runs
+func getCurrentNotifyStage(stages []NotifyStage, daysLeft int) *NotifyStage {
+	var current *NotifyStage
+	for i, stage := range stages {
+		if stage.DaysBeforePurge >= daysLeft {
+			current = &stages[i]
+		}
+	}
+	return current
+}
+
+// errStagesNeedLedger is returned when several reminder stages are set
+// without a ledger, which would re-send the current stage on every run
+var errStagesNeedLedger = errors.New("notify stages need LEDGER_FILE so each stage is sent once")
+
+// validateNotifyStages checks configured stages for duplicates and unusable values
+func validateNotifyStages(stages []NotifyStage) error {
+	names := map[string]bool{}
+	days := map[int]bool{}
+	for _, stage := range stages {
+		if stage.DaysBeforePurge <= 0 {
+			return fmt.Errorf("stage %s must have days_before_purge greater than 0", stage.Name)
+		}
+		if days[stage.DaysBeforePurge] {
+			return fmt.Errorf("more than one stage has days_before_purge %d", stage.DaysBeforePurge)
+		}
+		days[stage.DaysBeforePurge] = true
+		if stage.Name != "" && names[stage.Name] {
+			return fmt.Errorf("more than one stage is named %s", stage.Name)
+		}
+		names[stage.Name] = true
+		if stage.Template != "" && filepath.Base(stage.Template) != stage.Template {
+			return fmt.Errorf("stage %s template %s must be a file name in the templates directory", stage.Name, stage.Template)
+		}
+	}
+	return nil
+}
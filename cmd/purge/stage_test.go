@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListNotifyStages(t *testing.T) {
+	testCases := map[string]struct {
+		opts           Options
+		expectedStages []NotifyStage
+	}{
+		"defaults to a single stage at notify days": {
+			opts: Options{
+				NotifyDays:        25,
+				PurgeDays:         30,
+				NotifyMailSubject: "notify",
+			},
+			expectedStages: []NotifyStage{
+				{Name: "notify", DaysBeforePurge: 5, Subject: "notify", Template: defaultNotifyTemplate},
+			},
+		},
+		"orders notify stage days and ends with the final warning": {
+			opts: Options{
+				NotifyDays:             25,
+				PurgeDays:              30,
+				NotifyStageDays:        []int{1, 7, 2},
+				NotifyMailSubject:      "notify",
+				FinalNotifyMailSubject: "final",
+			},
+			expectedStages: []NotifyStage{
+				{Name: "7-days", DaysBeforePurge: 7, Subject: "notify", Template: defaultNotifyTemplate},
+				{Name: "2-days", DaysBeforePurge: 2, Subject: "notify", Template: defaultNotifyTemplate},
+				{Name: "final", DaysBeforePurge: 1, Subject: "final", Template: finalNotifyTemplate},
+			},
+		},
+		"single notify stage day is not a final warning": {
+			opts: Options{
+				PurgeDays:         30,
+				NotifyStageDays:   []int{3},
+				NotifyMailSubject: "notify",
+			},
+			expectedStages: []NotifyStage{
+				{Name: "3-days", DaysBeforePurge: 3, Subject: "notify", Template: defaultNotifyTemplate},
+			},
+		},
+		"policy stages take precedence and fill in defaults": {
+			opts: Options{
+				PurgeDays:         30,
+				NotifyStageDays:   []int{7, 2, 1},
+				NotifyMailSubject: "notify",
+				NotifyStages: []NotifyStage{
+					{Name: "last-call", DaysBeforePurge: 1, Subject: "last call", Template: "notify-final.tmpl"},
+					{DaysBeforePurge: 10},
+				},
+			},
+			expectedStages: []NotifyStage{
+				{Name: "10-days", DaysBeforePurge: 10, Subject: "notify", Template: defaultNotifyTemplate},
+				{Name: "last-call", DaysBeforePurge: 1, Subject: "last call", Template: "notify-final.tmpl"},
+			},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			stages := listNotifyStages(test.opts)
+			if diff := cmp.Diff(test.expectedStages, stages); diff != "" {
+				t.Errorf("ListNotifyStages() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateNotifyStages(t *testing.T) {
+	testCases := map[string]struct {
+		stages      []NotifyStage
+		expectedErr string
+	}{
+		"valid stages": {
+			stages: []NotifyStage{
+				{Name: "first", DaysBeforePurge: 7},
+				{Name: "final", DaysBeforePurge: 1, Template: "notify-final.tmpl"},
+			},
+		},
+		"stage on purge day": {
+			stages: []NotifyStage{
+				{Name: "late", DaysBeforePurge: 0},
+			},
+			expectedErr: "stage late must have days_before_purge greater than 0",
+		},
+		"duplicate days": {
+			stages: []NotifyStage{
+				{Name: "first", DaysBeforePurge: 2},
+				{Name: "second", DaysBeforePurge: 2},
+			},
+			expectedErr: "more than one stage has days_before_purge 2",
+		},
+		"duplicate names": {
+			stages: []NotifyStage{
+				{Name: "first", DaysBeforePurge: 2},
+				{Name: "first", DaysBeforePurge: 1},
+			},
+			expectedErr: "more than one stage is named first",
+		},
+		"template outside templates directory": {
+			stages: []NotifyStage{
+				{Name: "first", DaysBeforePurge: 2, Template: "../notify.tmpl"},
+			},
+			expectedErr: "stage first template ../notify.tmpl must be a file name in the templates directory",
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := validateNotifyStages(test.stages)
+			if (test.expectedErr == "" && err != nil) || (test.expectedErr != "" && (err == nil || test.expectedErr != err.Error())) {
+				t.Fatalf("expected error: %s, got: %s", test.expectedErr, err)
+			}
+		})
+	}
+}
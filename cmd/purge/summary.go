@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+)
+
+const (
+	// exitPartialFailure means some actions failed and others succeeded
+	exitPartialFailure = 2
+	// exitTotalFailure means every action failed
+	exitTotalFailure = 3
+)
+
+// runFailure describes a failed org or space action
+type runFailure struct {
+	Org    string `json:"org"`
+	Space  string `json:"space,omitempty"`
+	Action string `json:"action"`
+	Error  string `json:"error"`
+}
+
+// runSummary describes the outcome of a run; Pending counts purges whose
+// delete job was still running, which later runs finish
+type runSummary struct {
+	Succeeded int          `json:"succeeded"`
+	Pending   int          `json:"pending,omitempty"`
+	Failures  []runFailure `json:"failures"`
+}
+
+// newRunSummary collects plan errors and action results, sorted by org,
+// action and space so the report doesn't depend on the order work finished
+func newRunSummary(plan *Plan, results []actionResult) runSummary {
+	summary := runSummary{Failures: []runFailure{}}
+	for _, org := range plan.Orgs {
+		for _, planErr := range org.Errors {
+			summary.Failures = append(summary.Failures, runFailure{
+				Org:    org.Org.Name,
+				Action: "plan",
+				Error:  planErr,
+			})
+		}
+	}
+	for _, result := range results {
+		if result.Err == nil || errors.Is(result.Err, ErrAlreadyNotified) {
+			summary.Succeeded++
+			continue
+		}
+		if errors.Is(result.Err, ErrSpaceDeletePending) {
+			summary.Pending++
+			continue
+		}
+		summary.Failures = append(summary.Failures, runFailure{
+			Org:    result.Org,
+			Space:  result.Space,
+			Action: result.Action,
+			Error:  result.Err.Error(),
+		})
+	}
+
+	sort.SliceStable(summary.Failures, func(i, j int) bool {
+		a, b := summary.Failures[i], summary.Failures[j]
+		if a.Org != b.Org {
+			return a.Org < b.Org
+		}
+		if a.Action != b.Action {
+			return a.Action < b.Action
+		}
+		return a.Space < b.Space
+	})
+	return summary
+}
+
+// exitCode returns 0 if nothing failed, exitTotalFailure if nothing
+// succeeded, and exitPartialFailure otherwise
+func (s runSummary) exitCode() int {
+	switch {
+	case len(s.Failures) == 0:
+		return 0
+	case s.Succeeded == 0:
+		return exitTotalFailure
+	default:
+		return exitPartialFailure
+	}
+}
+
+// logRunSummary logs the summary, with one line per failure
+func logRunSummary(ctx context.Context, summary *runSummary) {
+	slog.InfoContext(ctx, "run summary", "succeeded", summary.Succeeded, "pending", summary.Pending, "failed", len(summary.Failures))
+	for _, failure := range summary.Failures {
+		slog.ErrorContext(ctx, "run failure", "org", failure.Org, "space", failure.Space, "phase", failure.Action, "error", failure.Error)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudfoundry-community/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunSummary(t *testing.T) {
+	smtpErr := errors.New("550 mailbox unavailable")
+	plan := &Plan{
+		Orgs: []PlanOrg{
+			{Org: &resource.Organization{Name: "sandbox-b"}},
+			{
+				Org:    &resource.Organization{Name: "sandbox-a"},
+				Errors: []string{"error listing org resources for org sandbox-a: timeout"},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		plan             *Plan
+		results          []actionResult
+		expectedFailures []runFailure
+		expectedPending  int
+		expectedExitCode int
+	}{
+		"all succeeded": {
+			plan: &Plan{},
+			results: []actionResult{
+				{Org: "sandbox-a", Space: "space-1", Action: actionNotify},
+				{Org: "sandbox-a", Space: "space-2", Action: actionPurge},
+			},
+			expectedFailures: []runFailure{},
+		},
+		"notify failure does not stop other actions": {
+			plan: plan,
+			results: []actionResult{
+				{Org: "sandbox-b", Space: "space-2", Action: actionNotify, Err: smtpErr},
+				{Org: "sandbox-b", Space: "space-1", Action: actionNotify, Err: smtpErr},
+				{Org: "sandbox-b", Space: "space-3", Action: actionPurge},
+			},
+			expectedFailures: []runFailure{
+				{Org: "sandbox-a", Action: "plan", Error: "error listing org resources for org sandbox-a: timeout"},
+				{Org: "sandbox-b", Space: "space-1", Action: actionNotify, Error: smtpErr.Error()},
+				{Org: "sandbox-b", Space: "space-2", Action: actionNotify, Error: smtpErr.Error()},
+			},
+			expectedExitCode: exitPartialFailure,
+		},
+		"spaces already notified are not failures": {
+			plan: &Plan{},
+			results: []actionResult{
+				{Org: "sandbox-a", Space: "space-1", Action: actionNotify, Err: ErrAlreadyNotified},
+			},
+			expectedFailures: []runFailure{},
+		},
+		"pending deletes are neither purged nor failed": {
+			plan: &Plan{},
+			results: []actionResult{
+				{Org: "sandbox-a", Space: "space-1", Action: actionPurge, Err: ErrSpaceDeletePending},
+			},
+			expectedFailures: []runFailure{},
+			expectedPending:  1,
+		},
+		"everything failed": {
+			plan: &Plan{},
+			results: []actionResult{
+				{Org: "sandbox-a", Space: "space-1", Action: actionNotify, Err: smtpErr},
+			},
+			expectedFailures: []runFailure{
+				{Org: "sandbox-a", Space: "space-1", Action: actionNotify, Error: smtpErr.Error()},
+			},
+			expectedExitCode: exitTotalFailure,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			summary := newRunSummary(test.plan, test.results)
+			if diff := cmp.Diff(test.expectedFailures, summary.Failures); diff != "" {
+				t.Errorf("failures mismatch (-want +got):\n%s", diff)
+			}
+			if summary.Pending != test.expectedPending {
+				t.Errorf("expected %d pending, got %d", test.expectedPending, summary.Pending)
+			}
+			if code := summary.exitCode(); code != test.expectedExitCode {
+				t.Errorf("expected exit code %d, got %d", test.expectedExitCode, code)
+			}
+		})
+	}
+}